@@ -0,0 +1,309 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/fs"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+    "time"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+)
+
+func (c *cli) get(args []string) error {
+    if err := needArgs(args, 1, 2, "get <url> [local]"); err != nil {
+        return err
+    }
+    src, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+
+    if len(args) == 2 && args[1] == "-" {
+        data, err := ftp.GetFTPBytes(src, c.options()...)
+        if err != nil {
+            return err
+        }
+        _, err = os.Stdout.Write(data)
+        return err
+    }
+
+    local := path.Base(urlPath(src))
+    if len(args) == 2 {
+        local = args[1]
+        if info, err := os.Stat(local); err == nil && info.IsDir() {
+            local = filepath.Join(local, path.Base(urlPath(src)))
+        }
+    }
+    return c.download(src, local)
+}
+
+func (c *cli) put(args []string) error {
+    if err := needArgs(args, 2, 2, "put <local> <url>"); err != nil {
+        return err
+    }
+    dst, err := c.resolve(args[1])
+    if err != nil {
+        return err
+    }
+
+    if args[0] == "-" {
+        if strings.HasSuffix(urlPath(dst), "/") {
+            return fmt.Errorf("%w: la URL debe incluir el nombre al leer de la entrada estándar", errUsage)
+        }
+        data, err := io.ReadAll(os.Stdin)
+        if err != nil {
+            return err
+        }
+        return ftp.PutFTPBytes(data, dst, c.options()...)
+    }
+
+    if strings.HasSuffix(urlPath(dst), "/") {
+        dst = joinURL(dst, filepath.Base(args[0]))
+    }
+    return c.upload(args[0], dst)
+}
+
+func (c *cli) ls(args []string) error {
+    if err := needArgs(args, 1, 1, "ls <url>"); err != nil {
+        return err
+    }
+    dir, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    entries, err := ftp.ReadFTPDir(dir, c.options()...)
+    if err != nil {
+        return err
+    }
+
+    if c.json {
+        if entries == nil {
+            entries = []ftp.FileInfo{}
+        }
+        return printJSON(entries)
+    }
+    for _, e := range entries {
+        fmt.Println(formatEntry(e))
+    }
+    return nil
+}
+
+func (c *cli) mkdir(args []string) error {
+    if err := needArgs(args, 1, 1, "mkdir <url>"); err != nil {
+        return err
+    }
+    dir, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    _, err = ftp.EnsureFTPDir(dir, c.options()...)
+    return err
+}
+
+func (c *cli) rm(args []string) error {
+    if err := needArgs(args, 1, -1, "rm <url>..."); err != nil {
+        return err
+    }
+    for _, arg := range args {
+        target, err := c.resolve(arg)
+        if err != nil {
+            return err
+        }
+        if err := ftp.DeleteFTPFile(target, c.options()...); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *cli) mv(args []string) error {
+    if err := needArgs(args, 2, 2, "mv <url> <destino>"); err != nil {
+        return err
+    }
+    src, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    return ftp.RenameFTPFile(src, args[1], c.options()...)
+}
+
+func (c *cli) stat(args []string) error {
+    if err := needArgs(args, 1, 1, "stat <url>"); err != nil {
+        return err
+    }
+    target, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    info, err := ftp.StatFTPFile(target, c.options()...)
+    if err != nil {
+        return err
+    }
+    if c.json {
+        return printJSON(info)
+    }
+    fmt.Println(formatEntry(info))
+    return nil
+}
+
+// mirror copia un árbol completo. Los archivos que ya existen en el destino
+// con el mismo tamaño se omiten.
+func (c *cli) mirror(args []string) error {
+    reverse := len(args) > 0 && args[0] == "-R"
+    if reverse {
+        args = args[1:]
+    }
+    if err := needArgs(args, 2, 2, "mirror [-R] <origen> <destino>"); err != nil {
+        return err
+    }
+
+    pool := ftp.NewPool(1, time.Minute)
+    defer pool.Close()
+    opts := append(c.options(), ftp.WithPool(pool))
+
+    if reverse {
+        dst, err := c.resolve(args[1])
+        if err != nil {
+            return err
+        }
+        return c.mirrorUp(args[0], dst, opts)
+    }
+    src, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    return c.mirrorDown(src, args[1], opts)
+}
+
+func (c *cli) mirrorDown(src, local string, opts []ftp.Option) error {
+    if err := os.MkdirAll(local, 0755); err != nil {
+        return err
+    }
+    entries, err := ftp.ReadFTPDir(src, opts...)
+    if err != nil {
+        return err
+    }
+    for _, e := range entries {
+        remote := joinURL(src, e.Name)
+        target := filepath.Join(local, e.Name)
+        if e.IsDir {
+            if err := c.mirrorDown(remote, target, opts); err != nil {
+                return err
+            }
+            continue
+        }
+        if info, err := os.Stat(target); err == nil && info.Size() == e.Size {
+            continue
+        }
+        c.logf("%s -> %s", urlPath(remote), target)
+        if err := c.download(remote, target, opts...); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *cli) mirrorUp(local, dst string, opts []ftp.Option) error {
+    return filepath.WalkDir(local, func(name string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        rel, err := filepath.Rel(local, name)
+        if err != nil {
+            return err
+        }
+        remote := dst
+        if rel != "." {
+            remote = joinURL(dst, filepath.ToSlash(rel))
+        }
+
+        if d.IsDir() {
+            _, err := ftp.EnsureFTPDir(remote, opts...)
+            return err
+        }
+        if !d.Type().IsRegular() {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+        if stat, err := ftp.StatFTPFile(remote, opts...); err == nil && stat.Size == info.Size() {
+            return nil
+        }
+        c.logf("%s -> %s", name, urlPath(remote))
+        return c.upload(name, remote, opts...)
+    })
+}
+
+// download y upload añaden el progreso a las opciones comunes.
+func (c *cli) download(src, local string, opts ...ftp.Option) error {
+    if len(opts) == 0 {
+        opts = c.options()
+    }
+    p := c.startProgress(path.Base(urlPath(src)))
+    err := ftp.DownloadFTPFile(src, local, append(opts, p.option()...)...)
+    p.done()
+    return err
+}
+
+func (c *cli) upload(local, dst string, opts ...ftp.Option) error {
+    if len(opts) == 0 {
+        opts = c.options()
+    }
+    p := c.startProgress(filepath.Base(local))
+    err := ftp.UploadFTPFile(local, dst, append(opts, p.option()...)...)
+    p.done()
+    return err
+}
+
+// logf escribe un mensaje informativo en la salida de error salvo con -q.
+func (c *cli) logf(format string, args ...any) {
+    if !c.quiet {
+        fmt.Fprintf(os.Stderr, format+"\n", args...)
+    }
+}
+
+func printJSON(v any) error {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(v)
+}
+
+func formatEntry(e ftp.FileInfo) string {
+    kind := "-"
+    if e.IsDir {
+        kind = "d"
+    }
+    modified := "                "
+    if !e.ModTime.IsZero() {
+        modified = e.ModTime.Format("2006-01-02 15:04")
+    }
+    return fmt.Sprintf("%s %12d %s %s", kind, e.Size, modified, e.Name)
+}
+
+// urlPath devuelve la ruta de una URL ya validada.
+func urlPath(rawUrl string) string {
+    u, err := url.Parse(rawUrl)
+    if err != nil {
+        return ""
+    }
+    return u.Path
+}
+
+// joinURL añade name a la ruta de base.
+func joinURL(base, name string) string {
+    u, err := url.Parse(base)
+    if err != nil {
+        return base
+    }
+    u.Path = path.Join(u.Path, name)
+    u.RawPath = ""
+    return u.String()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+    "golang.org/x/term"
+)
+
+// complete es el AutoCompleteCallback del shell: con Tab completa la orden o
+// la ruta remota o local según la posición del argumento. Si hay varias
+// opciones completa el prefijo común y, si no avanza, las muestra.
+func (s *shell) complete(line string, pos int, key rune) (string, int, bool) {
+    if key != '\t' {
+        return "", 0, false
+    }
+    prefix := line[:pos]
+    start := wordStart(prefix)
+    before, err := splitArgs(prefix[:start])
+    if err != nil {
+        return "", 0, false
+    }
+    word, err := splitArgs(prefix[start:])
+    if err != nil || len(word) > 1 {
+        return "", 0, false
+    }
+    current := ""
+    if len(word) == 1 {
+        current = word[0]
+    }
+
+    var candidates []string
+    if len(before) == 0 {
+        for name := range shellCommands {
+            if strings.HasPrefix(name, current) {
+                candidates = append(candidates, name+" ")
+            }
+        }
+    } else {
+        command, ok := shellCommands[before[0]]
+        if !ok || len(command.args) == 0 {
+            return "", 0, false
+        }
+        kind := command.args[min(len(before)-1, len(command.args)-1)]
+        candidates = s.pathCandidates(kind, current)
+    }
+    if len(candidates) == 0 {
+        return "", 0, false
+    }
+    sort.Strings(candidates)
+
+    completed := commonPrefix(candidates)
+    if len(candidates) > 1 && completed == current && s.term != nil {
+        s.term.Write([]byte(strings.Join(candidates, "  ") + "\n"))
+        return "", 0, false
+    }
+    completed = escapeArg(completed)
+    return prefix[:start] + completed + line[pos:], start + len(completed), true
+}
+
+// pathCandidates devuelve las rutas que empiezan por current; los directorios
+// terminan en "/" y los archivos en un espacio.
+func (s *shell) pathCandidates(kind argKind, current string) []string {
+    dir, name := "", current
+    if i := strings.LastIndex(current, "/"); i >= 0 {
+        dir, name = current[:i+1], current[i+1:]
+    }
+
+    var entries []ftp.FileInfo
+    switch kind {
+    case argRemote:
+        entries = s.readDir(s.remote(dir))
+    case argLocal:
+        local := dir
+        if local == "" {
+            local = "."
+        }
+        files, _ := os.ReadDir(filepath.FromSlash(local))
+        for _, f := range files {
+            entries = append(entries, ftp.FileInfo{Name: f.Name(), IsDir: f.IsDir()})
+        }
+    }
+
+    var candidates []string
+    for _, e := range entries {
+        if !strings.HasPrefix(e.Name, name) || (name == "" && strings.HasPrefix(e.Name, ".")) {
+            continue
+        }
+        if e.IsDir {
+            candidates = append(candidates, dir+e.Name+"/")
+        } else {
+            candidates = append(candidates, dir+e.Name+" ")
+        }
+    }
+    return candidates
+}
+
+// readDir lista un directorio remoto reutilizando el listado mientras no se
+// ejecute otra orden.
+func (s *shell) readDir(dir string) []ftp.FileInfo {
+    if entries, ok := s.dirs[dir]; ok {
+        return entries
+    }
+    entries, err := ftp.ReadFTPDir(s.url(dir), s.opts...)
+    if err != nil {
+        return nil
+    }
+    if s.dirs == nil {
+        s.dirs = make(map[string][]ftp.FileInfo)
+    }
+    s.dirs[dir] = entries
+    return entries
+}
+
+// wordStart devuelve dónde empieza la última palabra de line.
+func wordStart(line string) int {
+    start := 0
+    escaped := false
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        switch c := line[i]; {
+        case escaped:
+            escaped = false
+        case c == '\\' && quote != '\'':
+            escaped = true
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == ' ' || c == '\t':
+            start = i + 1
+        }
+    }
+    return start
+}
+
+func commonPrefix(values []string) string {
+    prefix := values[0]
+    for _, v := range values[1:] {
+        for !strings.HasPrefix(v, prefix) {
+            prefix = prefix[:len(prefix)-1]
+        }
+    }
+    return prefix
+}
+
+// escapeArg escapa lo que splitArgs trataría como separador o comilla,
+// salvo el espacio final que añade la completación.
+func escapeArg(arg string) string {
+    body, suffix := strings.CutSuffix(arg, " ")
+    var b strings.Builder
+    for _, r := range body {
+        if strings.ContainsRune(" \t\\\"'", r) {
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    if suffix {
+        b.WriteByte(' ')
+    }
+    return b.String()
+}
+
+// history guarda las órdenes del shell en ~/.ftpcli_history.
+type history struct {
+    path  string
+    lines []string // de la más antigua a la más reciente
+}
+
+const historySize = 1000
+
+func loadHistory() *history {
+    h := &history{}
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return h
+    }
+    h.path = filepath.Join(home, ".ftpcli_history")
+    if data, err := os.ReadFile(h.path); err == nil && len(data) > 0 {
+        h.lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+    }
+    return h
+}
+
+func (h *history) Add(entry string) {
+    if n := len(h.lines); n > 0 && h.lines[n-1] == entry {
+        return
+    }
+    h.lines = append(h.lines, entry)
+    if len(h.lines) > historySize {
+        h.lines = h.lines[len(h.lines)-historySize:]
+    }
+}
+
+func (h *history) Len() int {
+    return len(h.lines)
+}
+
+func (h *history) At(idx int) string {
+    return h.lines[len(h.lines)-1-idx]
+}
+
+func (h *history) save() {
+    if h.path == "" || len(h.lines) == 0 {
+        return
+    }
+    os.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+}
+
+var _ term.History = (*history)(nil)
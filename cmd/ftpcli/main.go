@@ -0,0 +1,173 @@
+// Command ftpcli expone la biblioteca FTP/SFTP en la línea de comandos.
+//
+//	ftpcli [opciones] <comando> [argumentos]
+//
+// El código de salida es 0 si todo fue bien, el valor absoluto del código
+// Err* de la biblioteca si falló (6 para ErrConnectionFailed, por ejemplo),
+// 64 si los argumentos no son válidos y 100 ante cualquier otro error.
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "net/url"
+    "os"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+)
+
+const (
+    exitUsage = 64
+    exitOther = 100
+)
+
+const usage = `Uso: ftpcli [opciones] <comando> [argumentos]
+
+Comandos:
+  get <url> [local]            descarga (local "-" escribe en la salida estándar)
+  put <local> <url>            sube (local "-" lee la entrada estándar; url
+                               terminada en "/" conserva el nombre)
+  ls <url>                     lista un directorio
+  mkdir <url>                  crea un directorio
+  rm <url>...                  elimina archivos o directorios vacíos
+  mv <url> <destino>           renombra; destino es una ruta o una URL del
+                               mismo servidor
+  stat <url>                   muestra tipo, tamaño y fecha
+  mirror [-R] <origen> <dest>  copia un directorio remoto a uno local, o uno
+                               local al servidor con -R
+  shell <url>                  abre una sesión interactiva en el directorio
+
+Las credenciales que falten en la URL se toman de -user/-password, del
+archivo de credenciales (FTP_CREDENTIALS), de netrc o de
+FTP_USER/FTP_PASSWORD.
+
+Opciones:
+`
+
+// errUsage marca los errores de argumentos.
+var errUsage = errors.New("argumentos inválidos")
+
+// cli guarda las opciones globales.
+type cli struct {
+    user     string
+    password string
+    netrc    string
+    profiles string
+    json     bool
+    quiet    bool
+    retries  int
+}
+
+func main() {
+    c := &cli{}
+    flags := flag.NewFlagSet("ftpcli", flag.ContinueOnError)
+    flags.StringVar(&c.user, "user", "", "usuario si la URL no lo incluye")
+    flags.StringVar(&c.password, "password", "", "contraseña si la URL no la incluye")
+    flags.StringVar(&c.netrc, "netrc", "", "archivo netrc (por defecto $NETRC o ~/.netrc)")
+    flags.StringVar(&c.profiles, "profiles", os.Getenv("FTP_PROFILES"), "archivo de perfiles YAML, JSON o TOML")
+    flags.BoolVar(&c.json, "json", false, "salida JSON en ls y stat")
+    flags.BoolVar(&c.quiet, "q", false, "no mostrar el progreso")
+    flags.IntVar(&c.retries, "retries", 3, "intentos ante errores transitorios")
+    flags.Usage = func() {
+        fmt.Fprint(os.Stderr, usage)
+        flags.PrintDefaults()
+    }
+    if err := flags.Parse(os.Args[1:]); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            os.Exit(0)
+        }
+        os.Exit(exitUsage)
+    }
+    if flags.NArg() == 0 {
+        flags.Usage()
+        os.Exit(exitUsage)
+    }
+
+    if c.netrc != "" {
+        os.Setenv("NETRC", c.netrc)
+    }
+    var err error
+    if c.profiles != "" {
+        err = ftp.LoadFTPProfiles(c.profiles)
+    }
+    if err == nil {
+        err = c.run(flags.Arg(0), flags.Args()[1:])
+    }
+    if err == nil {
+        return
+    }
+
+    fmt.Fprintln(os.Stderr, "ftpcli:", err)
+    switch {
+    case errors.Is(err, errUsage):
+        os.Exit(exitUsage)
+    case ftp.ErrorCode(err) < 0:
+        os.Exit(-ftp.ErrorCode(err))
+    default:
+        os.Exit(exitOther)
+    }
+}
+
+func (c *cli) run(command string, args []string) error {
+    switch command {
+    case "get":
+        return c.get(args)
+    case "put":
+        return c.put(args)
+    case "ls":
+        return c.ls(args)
+    case "mkdir":
+        return c.mkdir(args)
+    case "rm":
+        return c.rm(args)
+    case "mv":
+        return c.mv(args)
+    case "stat":
+        return c.stat(args)
+    case "mirror":
+        return c.mirror(args)
+    case "shell":
+        return c.shell(args)
+    }
+    return fmt.Errorf("%w: comando desconocido %q", errUsage, command)
+}
+
+// options devuelve las opciones comunes a todas las operaciones.
+func (c *cli) options() []ftp.Option {
+    policy := ftp.DefaultRetryPolicy()
+    policy.MaxAttempts = c.retries
+    return []ftp.Option{ftp.WithRetry(policy)}
+}
+
+// resolve valida la URL y le añade -user y -password si no trae
+// contraseña; el resto de fuentes de credenciales las resuelve la biblioteca.
+func (c *cli) resolve(rawUrl string) (string, error) {
+    u, err := url.Parse(rawUrl)
+    if err != nil || (u.Scheme != "ftp" && u.Scheme != "sftp") {
+        return "", fmt.Errorf("%w: URL inválida %q", errUsage, rawUrl)
+    }
+    if _, ok := u.User.Password(); ok {
+        return rawUrl, nil
+    }
+
+    user := u.User.Username()
+    if user == "" {
+        user = c.user
+    }
+    switch {
+    case c.password != "":
+        u.User = url.UserPassword(user, c.password)
+    case user != "":
+        u.User = url.User(user)
+    }
+    return u.String(), nil
+}
+
+// needArgs comprueba el número de argumentos de un comando.
+func needArgs(args []string, min, max int, syntax string) error {
+    if len(args) < min || (max >= 0 && len(args) > max) {
+        return fmt.Errorf("%w: uso: ftpcli %s", errUsage, syntax)
+    }
+    return nil
+}
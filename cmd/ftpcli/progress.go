@@ -0,0 +1,78 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+)
+
+// progress muestra el avance de una transferencia en la salida de error. Solo
+// se activa si es una terminal y no se pasó -q.
+type progress struct {
+    name  string
+    mu    sync.Mutex
+    last  time.Time
+    shown bool
+}
+
+func (c *cli) startProgress(name string) *progress {
+    if c.quiet {
+        return nil
+    }
+    if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+        return nil
+    }
+    return &progress{name: name}
+}
+
+func (p *progress) option() []ftp.Option {
+    if p == nil {
+        return nil
+    }
+    return []ftp.Option{ftp.WithProgress(p.update)}
+}
+
+func (p *progress) update(done, total int64) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    // Se redibuja como mucho diez veces por segundo y siempre al terminar
+    if time.Since(p.last) < 100*time.Millisecond && done != total {
+        return
+    }
+    p.last = time.Now()
+    p.shown = true
+    if total > 0 {
+        fmt.Fprintf(os.Stderr, "\r%s %s / %s (%d%%)\033[K", p.name, formatBytes(done), formatBytes(total), done*100/total)
+    } else {
+        fmt.Fprintf(os.Stderr, "\r%s %s\033[K", p.name, formatBytes(done))
+    }
+}
+
+// done cierra la línea de progreso.
+func (p *progress) done() {
+    if p == nil {
+        return
+    }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.shown {
+        fmt.Fprintln(os.Stderr)
+    }
+}
+
+func formatBytes(n int64) string {
+    const unit = 1024
+    if n < unit {
+        return fmt.Sprintf("%dB", n)
+    }
+    div, exp := int64(unit), 0
+    for m := n / unit; m >= unit; m /= unit {
+        div *= unit
+        exp++
+    }
+    return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+    "golang.org/x/term"
+)
+
+// shell es una sesión interactiva sobre un servidor. Todas las órdenes usan
+// un Pool de una conexión, así que la sesión FTP o SFTP se mantiene abierta
+// entre ellas.
+type shell struct {
+    cli  *cli
+    base *url.URL // esquema, servidor y credenciales
+    home string   // directorio inicial, destino de "cd" sin argumentos
+    cwd  string
+    pool *ftp.Pool
+    opts []ftp.Option
+    term *term.Terminal
+
+    // dirs guarda los listados usados al completar; se vacía tras cada orden
+    dirs map[string][]ftp.FileInfo
+}
+
+// shellCommand describe una orden y el tipo de cada argumento para completar.
+type shellCommand struct {
+    run  func(s *shell, args []string) error
+    args []argKind
+    help string
+}
+
+type argKind int
+
+const (
+    argRemote argKind = iota
+    argLocal
+)
+
+var shellCommands map[string]shellCommand
+
+func init() {
+    shellCommands = map[string]shellCommand{
+        "cd":    {(*shell).cd, []argKind{argRemote}, "cd [dir]           cambia el directorio remoto"},
+        "pwd":   {(*shell).pwd, nil, "pwd                muestra el directorio remoto"},
+        "ls":    {(*shell).ls, []argKind{argRemote}, "ls [dir]           lista el directorio remoto"},
+        "get":   {(*shell).get, []argKind{argRemote, argLocal}, "get <rem> [local]  descarga un archivo"},
+        "put":   {(*shell).put, []argKind{argLocal, argRemote}, "put <local> [rem]  sube un archivo"},
+        "mkdir": {(*shell).mkdir, []argKind{argRemote}, "mkdir <dir>        crea un directorio remoto"},
+        "rm":    {(*shell).rm, []argKind{argRemote}, "rm <rem>...        elimina archivos o directorios vacíos"},
+        "mv":    {(*shell).mv, []argKind{argRemote, argRemote}, "mv <rem> <rem>     renombra"},
+        "stat":  {(*shell).stat, []argKind{argRemote}, "stat <rem>         muestra tipo, tamaño y fecha"},
+        "lcd":   {(*shell).lcd, []argKind{argLocal}, "lcd [dir]          cambia el directorio local"},
+        "lpwd":  {(*shell).lpwd, nil, "lpwd               muestra el directorio local"},
+        "help":  {(*shell).help, nil, "help               muestra esta ayuda"},
+        "exit":  {nil, nil, "exit               termina la sesión"},
+    }
+}
+
+func (c *cli) shell(args []string) error {
+    if err := needArgs(args, 1, 1, "shell <url>"); err != nil {
+        return err
+    }
+    raw, err := c.resolve(args[0])
+    if err != nil {
+        return err
+    }
+    base, _ := url.Parse(raw)
+
+    s := &shell{cli: c, base: base, home: path.Clean("/" + base.Path), pool: ftp.NewPool(1, 0)}
+    defer s.pool.Close()
+    s.opts = append(c.options(), ftp.WithPool(s.pool))
+    s.cwd = s.home
+
+    // Se conecta ya para informar de credenciales o rutas erróneas
+    info, err := ftp.StatFTPFile(s.url(s.cwd), s.opts...)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir {
+        return fmt.Errorf("%w: %s no es un directorio", errUsage, s.cwd)
+    }
+
+    if !term.IsTerminal(int(os.Stdin.Fd())) {
+        return s.script(os.Stdin)
+    }
+    return s.interactive()
+}
+
+// script ejecuta las órdenes leídas de r, una por línea, y se detiene en el
+// primer error.
+func (s *shell) script(r io.Reader) error {
+    scanner := bufio.NewScanner(r)
+    for scanner.Scan() {
+        done, err := s.exec(scanner.Text())
+        if err != nil || done {
+            return err
+        }
+    }
+    return scanner.Err()
+}
+
+func (s *shell) interactive() error {
+    fd := int(os.Stdin.Fd())
+    state, err := term.MakeRaw(fd)
+    if err != nil {
+        return err
+    }
+    defer term.Restore(fd, state)
+
+    history := loadHistory()
+    t := term.NewTerminal(struct {
+        io.Reader
+        io.Writer
+    }{os.Stdin, os.Stdout}, "")
+    t.History = history
+    s.term = t
+    t.AutoCompleteCallback = s.complete
+    if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+        t.SetSize(width, height)
+    }
+
+    for {
+        t.SetPrompt(fmt.Sprintf("%s %s:%s> ", s.base.Scheme, s.base.Host, s.cwd))
+        line, err := t.ReadLine()
+        if err == io.EOF {
+            fmt.Fprint(t, "\n")
+            break
+        }
+        if err != nil {
+            return err
+        }
+
+        // Las órdenes se ejecutan con la terminal en modo normal para que
+        // su salida y el progreso se vean como fuera del shell
+        term.Restore(fd, state)
+        done, err := s.exec(line)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+        }
+        if _, err := term.MakeRaw(fd); err != nil {
+            return err
+        }
+        if done {
+            break
+        }
+    }
+    history.save()
+    return nil
+}
+
+// exec ejecuta una línea; done indica que la sesión debe terminar.
+func (s *shell) exec(line string) (done bool, err error) {
+    defer clear(s.dirs)
+
+    args, err := splitArgs(line)
+    if err != nil || len(args) == 0 {
+        return false, err
+    }
+    switch args[0] {
+    case "exit", "quit", "bye":
+        return true, nil
+    case "?":
+        args[0] = "help"
+    }
+    command, ok := shellCommands[args[0]]
+    if !ok {
+        return false, fmt.Errorf("orden desconocida %q; escriba help", args[0])
+    }
+    return false, command.run(s, args[1:])
+}
+
+// remote devuelve la ruta remota absoluta de name.
+func (s *shell) remote(name string) string {
+    if strings.HasPrefix(name, "/") {
+        return path.Clean(name)
+    }
+    return path.Join(s.cwd, name)
+}
+
+// url devuelve la URL de la ruta remota absoluta p.
+func (s *shell) url(p string) string {
+    u := *s.base
+    u.Path = p
+    u.RawPath = ""
+    return u.String()
+}
+
+func (s *shell) cd(args []string) error {
+    if err := needArgs(args, 0, 1, "cd [dir]"); err != nil {
+        return err
+    }
+    dir := s.home
+    if len(args) == 1 {
+        dir = s.remote(args[0])
+    }
+    info, err := ftp.StatFTPFile(s.url(dir), s.opts...)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir {
+        return fmt.Errorf("%s no es un directorio", dir)
+    }
+    s.cwd = dir
+    return nil
+}
+
+func (s *shell) pwd(args []string) error {
+    fmt.Println(s.cwd)
+    return nil
+}
+
+func (s *shell) ls(args []string) error {
+    if err := needArgs(args, 0, 1, "ls [dir]"); err != nil {
+        return err
+    }
+    dir := s.cwd
+    if len(args) == 1 {
+        dir = s.remote(args[0])
+    }
+    entries, err := ftp.ReadFTPDir(s.url(dir), s.opts...)
+    if err != nil {
+        return err
+    }
+    for _, e := range entries {
+        fmt.Println(formatEntry(e))
+    }
+    return nil
+}
+
+func (s *shell) get(args []string) error {
+    if err := needArgs(args, 1, 2, "get <remoto> [local]"); err != nil {
+        return err
+    }
+    remote := s.remote(args[0])
+    local := path.Base(remote)
+    if len(args) == 2 {
+        local = args[1]
+        if info, err := os.Stat(local); err == nil && info.IsDir() {
+            local = filepath.Join(local, path.Base(remote))
+        }
+    }
+    return s.cli.download(s.url(remote), local, s.opts...)
+}
+
+func (s *shell) put(args []string) error {
+    if err := needArgs(args, 1, 2, "put <local> [remoto]"); err != nil {
+        return err
+    }
+    remote := path.Join(s.cwd, filepath.Base(args[0]))
+    if len(args) == 2 {
+        remote = s.remote(args[1])
+        if strings.HasSuffix(args[1], "/") {
+            remote = path.Join(remote, filepath.Base(args[0]))
+        }
+    }
+    return s.cli.upload(args[0], s.url(remote), s.opts...)
+}
+
+func (s *shell) mkdir(args []string) error {
+    if err := needArgs(args, 1, 1, "mkdir <dir>"); err != nil {
+        return err
+    }
+    _, err := ftp.EnsureFTPDir(s.url(s.remote(args[0])), s.opts...)
+    return err
+}
+
+func (s *shell) rm(args []string) error {
+    if err := needArgs(args, 1, -1, "rm <remoto>..."); err != nil {
+        return err
+    }
+    for _, arg := range args {
+        if err := ftp.DeleteFTPFile(s.url(s.remote(arg)), s.opts...); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (s *shell) mv(args []string) error {
+    if err := needArgs(args, 2, 2, "mv <remoto> <remoto>"); err != nil {
+        return err
+    }
+    return ftp.RenameFTPFile(s.url(s.remote(args[0])), s.remote(args[1]), s.opts...)
+}
+
+func (s *shell) stat(args []string) error {
+    if err := needArgs(args, 1, 1, "stat <remoto>"); err != nil {
+        return err
+    }
+    info, err := ftp.StatFTPFile(s.url(s.remote(args[0])), s.opts...)
+    if err != nil {
+        return err
+    }
+    fmt.Println(formatEntry(info))
+    return nil
+}
+
+func (s *shell) lcd(args []string) error {
+    if err := needArgs(args, 0, 1, "lcd [dir]"); err != nil {
+        return err
+    }
+    dir, err := os.UserHomeDir()
+    if len(args) == 1 {
+        dir, err = args[0], nil
+    }
+    if err != nil {
+        return err
+    }
+    return os.Chdir(dir)
+}
+
+func (s *shell) lpwd(args []string) error {
+    dir, err := os.Getwd()
+    if err != nil {
+        return err
+    }
+    fmt.Println(dir)
+    return nil
+}
+
+func (s *shell) help(args []string) error {
+    for _, name := range []string{"ls", "cd", "pwd", "get", "put", "mkdir", "rm", "mv", "stat", "lcd", "lpwd", "help", "exit"} {
+        fmt.Println(shellCommands[name].help)
+    }
+    return nil
+}
+
+// splitArgs separa una línea en argumentos. Admite comillas simples y dobles
+// y espacios escapados con "\".
+func splitArgs(line string) ([]string, error) {
+    var args []string
+    var current strings.Builder
+    var quote rune
+    inArg, escaped := false, false
+    for _, r := range line {
+        switch {
+        case escaped:
+            current.WriteRune(r)
+            escaped = false
+        case r == '\\' && quote != '\'':
+            escaped, inArg = true, true
+        case quote != 0:
+            if r == quote {
+                quote = 0
+            } else {
+                current.WriteRune(r)
+            }
+        case r == '"' || r == '\'':
+            quote, inArg = r, true
+        case r == ' ' || r == '\t':
+            if inArg {
+                args = append(args, current.String())
+                current.Reset()
+                inArg = false
+            }
+        default:
+            current.WriteRune(r)
+            inArg = true
+        }
+    }
+    if quote != 0 || escaped {
+        return nil, errors.New("comillas sin cerrar")
+    }
+    if inArg {
+        args = append(args, current.String())
+    }
+    return args, nil
+}
@@ -2,353 +2,517 @@ package main
 
 /*
 #include <stdlib.h>
+#include <stdint.h>
+
+// dupFD duplica el descriptor fd para que Go pueda cerrar su copia sin
+// cerrar el del llamador. En Windows fd es un descriptor del CRT y se
+// duplica el HANDLE que hay detrás. Retorna -1 si fd no es válido.
+#ifdef _WIN32
+#include <io.h>
+#include <windows.h>
+static inline intptr_t dupFD(int fd) {
+    HANDLE h = (HANDLE)_get_osfhandle(fd), dup;
+    if (h == INVALID_HANDLE_VALUE ||
+        !DuplicateHandle(GetCurrentProcess(), h, GetCurrentProcess(), &dup, 0, FALSE, DUPLICATE_SAME_ACCESS)) {
+        return -1;
+    }
+    return (intptr_t)dup;
+}
+#else
+#include <unistd.h>
+static inline intptr_t dupFD(int fd) {
+    return dup(fd);
+}
+#endif
+
+// FTPDataCallback recibe cada fragmento descargado; retorna 0 para seguir u
+// otro valor para cancelar.
+typedef int (*FTPDataCallback)(const char* data, size_t len, void* userdata);
+
+// FTPFillCallback llena buf con hasta size bytes a subir y retorna cuántos
+// escribió, 0 al terminar o un valor negativo para cancelar.
+typedef int (*FTPFillCallback)(char* buf, size_t size, void* userdata);
+
+static inline int callDataCallback(FTPDataCallback cb, const char* data, size_t len, void* userdata) {
+    return cb(data, len, userdata);
+}
+
+static inline int callFillCallback(FTPFillCallback cb, char* buf, size_t size, void* userdata) {
+    return cb(buf, size, userdata);
+}
 */
 import "C"
 import (
-    "bytes"
+    "context"
     "encoding/base64"
-    "fmt"
-    "net"
-    "unsafe"
-    "time"
+    "encoding/json"
+    "errors"
     "io"
-    "strings"
-    "net/url"
-    "path/filepath"
+    "os"
     "strconv"
-    "github.com/pkg/sftp"
-    "golang.org/x/crypto/ssh"
-)
-
-const (
-    maxFileSize = 90 * 1024 * 1024 // 90MB límite
-    timeout     = 30 * time.Second
+    "strings"
+    "sync"
+    "time"
+    "unsafe"
+    ftp "github.com/IngenieroRicardo/ftp/go"
 )
 
 // Error codes (compatible with C)
 const (
-    ErrEmptyData        = -1
-    ErrEmptyURL         = -2
-    ErrInvalidScheme    = -3
-    ErrMissingHostUser  = -4
-    ErrMissingPath      = -5
-    ErrConnectionFailed = -6
-    ErrInitialRead      = -7
-    ErrUserSend         = -8
-    ErrUserAuth         = -9
-    ErrPassSend         = -10
-    ErrPassAuth         = -11
-    ErrMkdirFailed      = -12
-    ErrMkdirResponse    = -13
-    ErrPasvMode         = -14
-    ErrSizeCommand      = -15
-    ErrSizeResponse     = -16
-    ErrFileConflict     = -17
-    ErrCwdCommand       = -18
-    ErrCwdResponse      = -19
-    ErrTypeCommand      = -20
-    ErrStorCommand      = -21
-    ErrDataTransfer     = -22
-    ErrTransferConfirm  = -23
-    ErrAsciiMode        = -24
-    ErrSftpConnection   = -25
-    ErrSftpClient       = -26
-    ErrSftpOperation    = -27
+    ErrEmptyData           = ftp.ErrEmptyData
+    ErrEmptyURL            = ftp.ErrEmptyURL
+    ErrInvalidScheme       = ftp.ErrInvalidScheme
+    ErrMissingHostUser     = ftp.ErrMissingHostUser
+    ErrMissingPath         = ftp.ErrMissingPath
+    ErrConnectionFailed    = ftp.ErrConnectionFailed
+    ErrInitialRead         = ftp.ErrInitialRead
+    ErrUserSend            = ftp.ErrUserSend
+    ErrUserAuth            = ftp.ErrUserAuth
+    ErrPassSend            = ftp.ErrPassSend
+    ErrPassAuth            = ftp.ErrPassAuth
+    ErrMkdirFailed         = ftp.ErrMkdirFailed
+    ErrMkdirResponse       = ftp.ErrMkdirResponse
+    ErrPasvMode            = ftp.ErrPasvMode
+    ErrSizeCommand         = ftp.ErrSizeCommand
+    ErrSizeResponse        = ftp.ErrSizeResponse
+    ErrFileConflict        = ftp.ErrFileConflict
+    ErrCwdCommand          = ftp.ErrCwdCommand
+    ErrCwdResponse         = ftp.ErrCwdResponse
+    ErrTypeCommand         = ftp.ErrTypeCommand
+    ErrStorCommand         = ftp.ErrStorCommand
+    ErrDataTransfer        = ftp.ErrDataTransfer
+    ErrTransferConfirm     = ftp.ErrTransferConfirm
+    ErrAsciiMode           = ftp.ErrAsciiMode
+    ErrSftpConnection      = ftp.ErrSftpConnection
+    ErrSftpClient          = ftp.ErrSftpClient
+    ErrSftpOperation       = ftp.ErrSftpOperation
+    ErrInvalidOption       = ftp.ErrInvalidOption
+    ErrCanceled            = ftp.ErrCanceled
+    ErrDeleteFailed        = ftp.ErrDeleteFailed
+    ErrRenameFailed        = ftp.ErrRenameFailed
+    ErrInvalidPath         = ftp.ErrInvalidPath
+    ErrChecksumMismatch    = ftp.ErrChecksumMismatch
+    ErrChecksumUnsupported = ftp.ErrChecksumUnsupported
+    ErrWriteRefused        = ftp.ErrWriteRefused
 )
 
-func parsePASV(resp string) (string, error) {
-    start := strings.Index(resp, "(")
-    end := strings.Index(resp, ")")
-    if start == -1 || end == -1 {
-        return "", fmt.Errorf("formato PASV inválido")
-    }
-    parts := strings.Split(resp[start+1:end], ",")
-    if len(parts) < 6 {
-        return "", fmt.Errorf("formato PASV inválido")
+// errorCode convierte el error de la biblioteca Go en el código devuelto a C.
+func errorCode(err error) C.int {
+    if err == nil {
+        return C.int(0)
     }
-    ip := strings.Join(parts[0:4], ".")
-    p1, err1 := strconv.Atoi(parts[4])
-    p2, err2 := strconv.Atoi(parts[5])
-    if err1 != nil || err2 != nil {
-        return "", fmt.Errorf("puerto PASV inválido")
+    if code := ftp.ErrorCode(err); code != 0 {
+        return C.int(code)
     }
-    port := p1*256 + p2
-    return fmt.Sprintf("%s:%d", ip, port), nil
+    return C.int(ErrDataTransfer)
 }
 
-func isSFTP(urlStr string) bool {
-    u, err := url.Parse(urlStr)
-    if err != nil {
-        return false
+// cStringArray copia list a un arreglo de C terminado en NULL.
+func cStringArray(list []string) **C.char {
+    if len(list) == 0 {
+        return nil
     }
-    return u.Scheme == "sftp"
-}
 
+    // Allocate space for the array plus one extra for NULL terminator
+    cArray := C.malloc(C.size_t(len(list)+1) * C.size_t(unsafe.Sizeof(uintptr(0))))
+    if cArray == nil {
+        return nil
+    }
+    goArray := (*[1<<30 - 1]*C.char)(unsafe.Pointer(cArray))[:len(list)+1:len(list)+1]
+    for i, item := range list {
+        goArray[i] = C.CString(item)
+    }
+    goArray[len(list)] = nil // NULL terminator
+    return (**C.char)(cArray)
+}
 
-func createSFTPClient(ftpUrl string) (*sftp.Client, *ssh.Client, error) {
-    u, err := url.Parse(ftpUrl)
+// GetFTPFile retorna el archivo en base64; un archivo vacío da "" y no NULL.
+//
+//export GetFTPFile
+func GetFTPFile(ftpUrl *C.char) *C.char {
+    data, err := ftp.GetFTPBytes(C.GoString(ftpUrl))
     if err != nil {
-        return nil, nil, fmt.Errorf("error parsing URL: %v", err)
+        return nil
     }
+    return C.CString(base64.StdEncoding.EncodeToString(data))
+}
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    if !strings.Contains(host, ":") {
-        host += ":22"
+// GetFTPText retorna el texto del archivo; un archivo vacío da "" y no NULL.
+//
+//export GetFTPText
+func GetFTPText(ftpUrl *C.char) *C.char {
+    text, err := ftp.ReadFTPText(C.GoString(ftpUrl))
+    if err != nil {
+        return nil
     }
+    return C.CString(text)
+}
 
-    config := &ssh.ClientConfig{
-        User: user,
-        Auth: []ssh.AuthMethod{
-            ssh.Password(pass),
-        },
-        HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-        Timeout:         timeout,
+//export PutFTPFile
+func PutFTPFile(base64Data, ftpUrl *C.char) C.int {
+    base64Str := C.GoString(base64Data)
+    urlStr := C.GoString(ftpUrl)
+    if base64Str == "" {
+        return C.int(ErrEmptyData)
     }
-
-    conn, err := ssh.Dial("tcp", host, config)
-    if err != nil {
-        return nil, nil, fmt.Errorf("error code %d: failed to connect to SFTP server: %v", ErrSftpConnection, err)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    client, err := sftp.NewClient(conn)
-    if err != nil {
-        conn.Close()
-        return nil, nil, fmt.Errorf("error code %d: failed to create SFTP client: %v", ErrSftpClient, err)
+    if _, err := base64.StdEncoding.DecodeString(base64Str); err != nil {
+        return C.int(-3) // Error decodificando base64
     }
 
-    return client, conn, nil
+    return errorCode(ftp.PutFTPFile(base64Str, urlStr))
 }
 
-
-
-//export GetFTPFile
-func GetFTPFile(ftpUrl *C.char) *C.char {
+//export PutFTPText
+func PutFTPText(textData, ftpUrl *C.char) C.int {
+    textStr := C.GoString(textData)
     urlStr := C.GoString(ftpUrl)
+    if textStr == "" {
+        return C.int(ErrEmptyData)
+    }
     if urlStr == "" {
-        return nil
+        return C.int(ErrEmptyURL)
     }
 
-    if isSFTP(urlStr) {
-        return C.CString(GetSFTPFile(urlStr))
+    return errorCode(ftp.PutFTPText(textStr, urlStr))
+}
+
+//export AppendFTPFile
+func AppendFTPFile(base64Data, ftpUrl *C.char) C.int {
+    base64Str := C.GoString(base64Data)
+    urlStr := C.GoString(ftpUrl)
+    if base64Str == "" {
+        return C.int(ErrEmptyData)
+    }
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil || u.Scheme != "ftp" {
-        return nil
+    if _, err := base64.StdEncoding.DecodeString(base64Str); err != nil {
+        return C.int(-3) // Error decodificando base64
     }
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
+    return errorCode(ftp.AppendFTPFile(base64Str, urlStr))
+}
 
-    if !strings.Contains(host, ":") {
-        host += ":21"
+//export AppendFTPText
+func AppendFTPText(textData, ftpUrl *C.char) C.int {
+    textStr := C.GoString(textData)
+    urlStr := C.GoString(ftpUrl)
+    if textStr == "" {
+        return C.int(ErrEmptyData)
     }
-
-    if host == "" || user == "" {
-        return nil
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return nil
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
+    return errorCode(ftp.AppendFTPText(textStr, urlStr))
+}
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+// GetFTPBytes retorna el contenido del archivo en un buffer de malloc, sin
+// base64, y deja su tamaño en outLen. Un archivo vacío da un buffer no NULL
+// de tamaño 0. Retorna NULL si falla. Liberar con FreeFTPBuffer.
+//
+//export GetFTPBytes
+func GetFTPBytes(ftpUrl *C.char, outLen *C.size_t) unsafe.Pointer {
+    if outLen != nil {
+        *outLen = 0
+    }
+    data, err := ftp.GetFTPBytes(C.GoString(ftpUrl))
     if err != nil {
         return nil
     }
-
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return nil
+    if len(data) == 0 {
+        // malloc(0) puede dar NULL, que indicaría un error
+        return C.malloc(1)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return nil
+    if outLen != nil {
+        *outLen = C.size_t(len(data))
     }
+    return C.CBytes(data)
+}
 
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return nil
+// PutFTPBytes sube length bytes de data sin pasar por base64. length 0 crea
+// un archivo vacío.
+//
+//export PutFTPBytes
+func PutFTPBytes(data unsafe.Pointer, length C.size_t, ftpUrl *C.char) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return nil
+    if data == nil && length > 0 {
+        return C.int(ErrEmptyData)
     }
 
-    if _, err := fmt.Fprintf(conn, "TYPE I\r\n"); err != nil {
-        return nil
+    // La subida termina antes de retornar, así que se lee el buffer de C
+    // directamente en lugar de copiarlo
+    var buf []byte
+    if length > 0 {
+        buf = unsafe.Slice((*byte)(data), int(length))
     }
-    conn.Read(buf[:])
+    return errorCode(ftp.PutFTPBytes(buf, urlStr))
+}
 
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
+//export FreeFTPBuffer
+func FreeFTPBuffer(buf unsafe.Pointer) {
+    C.free(buf)
+}
+
+// PutFTPFileUnique sube los datos con un nombre que elige el servidor y
+// retorna la ruta asignada, o NULL si falla.
+//
+//export PutFTPFileUnique
+func PutFTPFileUnique(base64Data, ftpUrl *C.char) *C.char {
+    name, err := ftp.PutFTPFileUnique(C.GoString(base64Data), C.GoString(ftpUrl))
     if err != nil {
         return nil
     }
+    return C.CString(name)
+}
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return nil
+//export CreateFTPDir
+func CreateFTPDir(ftpUrl *C.char) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
+    existed, err := ftp.EnsureFTPDir(urlStr)
     if err != nil {
-        return nil
+        return errorCode(err)
+    }
+    if existed {
+        return C.int(1) // Ya existe como directorio
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
+    return C.int(0) // Success
+}
 
-    if _, err := fmt.Fprintf(conn, "RETR %s\r\n", path); err != nil {
-        return nil
+//export ListFTPFiles
+func ListFTPFiles(dirPath *C.char) **C.char {
+    return cStringArray(ftp.ListFTPFiles(C.GoString(dirPath)))
+}
+
+//export FreeFTPList
+func FreeFTPList(arr **C.char) {
+    if arr == nil {
+        return
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return nil
+    for i := 0; ; i++ {
+        p := *(**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(arr)) + uintptr(i)*unsafe.Sizeof(*arr)))
+        if p == nil {
+            break
+        }
+        C.free(unsafe.Pointer(p))
     }
+    C.free(unsafe.Pointer(arr))
+}
 
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
+// GetFTPFeatures retorna en JSON las extensiones que anuncia el servidor
+// FTP, por ejemplo {"EPSV":"","MLST":"type*;size*;modify*;"}, o NULL si
+// falla.
+//
+//export GetFTPFeatures
+func GetFTPFeatures(ftpUrl *C.char) *C.char {
+    features, err := ftp.GetFTPFeatures(C.GoString(ftpUrl))
+    if err != nil {
         return nil
     }
-
-    if limitedReader.N <= 0 {
+    data, err := json.Marshal(features)
+    if err != nil {
         return nil
     }
+    return C.CString(string(data))
+}
 
-    if buffer.Len() == 0 {
+// ChecksumFTP retorna en hexadecimal el hash algo (crc32, md5, sha1, sha256
+// o sha512) del archivo remoto calculado por el servidor, o NULL si falla.
+//
+//export ChecksumFTP
+func ChecksumFTP(ftpUrl, algo *C.char) *C.char {
+    sum, err := ftp.ChecksumFTP(C.GoString(ftpUrl), C.GoString(algo))
+    if err != nil {
         return nil
     }
-
-    encoded := base64.StdEncoding.EncodeToString(buffer.Bytes())
-    return C.CString(encoded)
+    return C.CString(sum)
 }
 
-//export GetFTPText
-func GetFTPText(ftpUrl *C.char) *C.char {
+//export DownloadFTPFile
+func DownloadFTPFile(ftpUrl, localPath *C.char) C.int {
     urlStr := C.GoString(ftpUrl)
+    pathStr := C.GoString(localPath)
     if urlStr == "" {
-        return nil
-    }
-
-    if isSFTP(urlStr) {
-        return C.CString(GetSFTPText(urlStr))
+        return C.int(ErrEmptyURL)
     }
-
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil || u.Scheme != "ftp" {
-        return nil
+    if pathStr == "" {
+        return C.int(ErrMissingPath)
     }
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
+    return errorCode(ftp.DownloadFTPFile(urlStr, pathStr))
+}
 
-    if !strings.Contains(host, ":") {
-        host += ":21"
+//export UploadFTPFile
+func UploadFTPFile(localPath, ftpUrl *C.char) C.int {
+    pathStr := C.GoString(localPath)
+    urlStr := C.GoString(ftpUrl)
+    if pathStr == "" {
+        return C.int(ErrMissingPath)
     }
-
-    if host == "" || user == "" {
-        return nil
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return nil
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
+    return errorCode(ftp.UploadFTPFile(pathStr, urlStr))
+}
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
+// fdFile abre una copia de fd; el descriptor del llamador sigue abierto y
+// comparte la posición con ella.
+func fdFile(fd C.int) *os.File {
+    h := C.dupFD(fd)
+    if h < 0 {
         return nil
     }
+    return os.NewFile(uintptr(h), "fd")
+}
 
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return nil
+// GetFTPToFD escribe el archivo remoto en fd (una tubería, un socket o un
+// archivo abierto) a medida que se descarga. fd no se cierra.
+//
+//export GetFTPToFD
+func GetFTPToFD(ftpUrl *C.char, fd C.int) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return nil
+    file := fdFile(fd)
+    if file == nil {
+        return C.int(ErrInvalidOption)
     }
+    defer file.Close()
 
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return nil
+    return errorCode(ftp.GetFTPTo(urlStr, file))
+}
+
+// PutFTPFromFD sube lo que se lea de fd hasta el final. fd no se cierra.
+//
+//export PutFTPFromFD
+func PutFTPFromFD(fd C.int, ftpUrl *C.char) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return nil
+    file := fdFile(fd)
+    if file == nil {
+        return C.int(ErrInvalidOption)
     }
+    defer file.Close()
 
-    if _, err := fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return nil
-    }
-    conn.Read(buf[:])
+    return errorCode(ftp.PutFTPFrom(file, urlStr))
+}
 
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return nil
+var errCallbackAbort = errors.New("cancelado por el callback")
+
+// callbackWriter entrega cada fragmento descargado a un FTPDataCallback.
+type callbackWriter struct {
+    cb       C.FTPDataCallback
+    userdata unsafe.Pointer
+    cancel   context.CancelFunc
+}
+
+func (w callbackWriter) Write(b []byte) (int, error) {
+    if len(b) == 0 {
+        return 0, nil
     }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return nil
+    if C.callDataCallback(w.cb, (*C.char)(unsafe.Pointer(&b[0])), C.size_t(len(b)), w.userdata) != 0 {
+        w.cancel()
+        return 0, errCallbackAbort
     }
+    return len(b), nil
+}
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return nil
-    }
+// callbackReader pide a un FTPFillCallback los datos a subir.
+type callbackReader struct {
+    cb       C.FTPFillCallback
+    userdata unsafe.Pointer
+    cancel   context.CancelFunc
+}
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return nil
+func (r callbackReader) Read(b []byte) (int, error) {
+    if len(b) == 0 {
+        return 0, nil
+    }
+    n := int(C.callFillCallback(r.cb, (*C.char)(unsafe.Pointer(&b[0])), C.size_t(len(b)), r.userdata))
+    switch {
+    case n == 0:
+        return 0, io.EOF
+    case n < 0 || n > len(b):
+        r.cancel()
+        return 0, errCallbackAbort
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
+    return n, nil
+}
 
-    if _, err := fmt.Fprintf(conn, "RETR %s\r\n", path); err != nil {
-        return nil
+// StreamFTPFile llama a callback con cada fragmento del archivo remoto a
+// medida que se descarga, sin guardarlo entero. Los fragmentos solo son
+// válidos durante la llamada. Si la descarga se reanuda tras un corte, no se
+// repiten fragmentos. Si callback retorna distinto de 0 se cancela con -29.
+//
+//export StreamFTPFile
+func StreamFTPFile(ftpUrl *C.char, callback C.FTPDataCallback, userdata unsafe.Pointer) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return nil
+    if callback == nil {
+        return C.int(ErrInvalidOption)
     }
 
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return nil
-    }
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    w := callbackWriter{cb: callback, userdata: userdata, cancel: cancel}
+    return errorCode(ftp.GetFTPTo(urlStr, w, ftp.WithContext(ctx)))
+}
 
-    if limitedReader.N <= 0 {
-        return nil
+// StreamFTPUpload sube los datos que va dando callback hasta que retorna 0.
+// Un valor negativo cancela la subida con -29.
+//
+//export StreamFTPUpload
+func StreamFTPUpload(ftpUrl *C.char, callback C.FTPFillCallback, userdata unsafe.Pointer) C.int {
+    urlStr := C.GoString(ftpUrl)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
+    }
+    if callback == nil {
+        return C.int(ErrInvalidOption)
     }
 
-    if buffer.Len() == 0 {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    r := callbackReader{cb: callback, userdata: userdata, cancel: cancel}
+    return errorCode(ftp.PutFTPFrom(r, urlStr, ftp.WithContext(ctx)))
+}
+
+// Las variantes *Digest hacen lo mismo que la función original y, si la
+// transferencia termina bien y digests no es NULL, dejan en *digests el JSON
+// {"md5":"...","sha256":"...","crc32":"..."} de los bytes transferidos, que
+// el llamador libera con free.
+
+//export GetFTPFileDigest
+func GetFTPFileDigest(ftpUrl *C.char, digests **C.char) *C.char {
+    var d ftp.Digests
+    data, err := ftp.GetFTPBytes(C.GoString(ftpUrl), ftp.WithDigests(&d))
+    if err != nil {
         return nil
     }
-
-    text := buffer.String()
-    text = strings.ReplaceAll(text, "\r\n", "\n")
-    text = strings.TrimSpace(text)
-    return C.CString(text)
+    storeDigests(digests, d)
+    return C.CString(base64.StdEncoding.EncodeToString(data))
 }
 
-//export PutFTPFile
-func PutFTPFile(base64Data, ftpUrl *C.char) C.int {
+//export PutFTPFileDigest
+func PutFTPFileDigest(base64Data, ftpUrl *C.char, digests **C.char) C.int {
     base64Str := C.GoString(base64Data)
     urlStr := C.GoString(ftpUrl)
     if base64Str == "" {
@@ -358,745 +522,436 @@ func PutFTPFile(base64Data, ftpUrl *C.char) C.int {
         return C.int(ErrEmptyURL)
     }
 
-    data, err := base64.StdEncoding.DecodeString(base64Str)
-    if err != nil {
-        return C.int(-3) // Error decodificando base64
-    }
-
-    if isSFTP(urlStr) {
-        err := PutSFTPFile(base64Str, urlStr)
-        if err != nil {
-            return C.int(ErrSftpOperation)
-        }
-        return C.int(0)
+    var d ftp.Digests
+    if err := ftp.PutFTPFile(base64Str, urlStr, ftp.WithDigests(&d)); err != nil {
+        return errorCode(err)
     }
+    storeDigests(digests, d)
+    return C.int(0)
+}
 
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil {
+//export DownloadFTPFileDigest
+func DownloadFTPFileDigest(ftpUrl, localPath *C.char, digests **C.char) C.int {
+    urlStr := C.GoString(ftpUrl)
+    pathStr := C.GoString(localPath)
+    if urlStr == "" {
         return C.int(ErrEmptyURL)
     }
-    if u.Scheme != "ftp" {
-        return C.int(ErrInvalidScheme)
+    if pathStr == "" {
+        return C.int(ErrMissingPath)
     }
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
+    var d ftp.Digests
+    if err := ftp.DownloadFTPFile(urlStr, pathStr, ftp.WithDigests(&d)); err != nil {
+        return errorCode(err)
     }
+    storeDigests(digests, d)
+    return C.int(0)
+}
 
-    if host == "" || user == "" {
-        return C.int(ErrMissingHostUser)
+//export UploadFTPFileDigest
+func UploadFTPFileDigest(localPath, ftpUrl *C.char, digests **C.char) C.int {
+    pathStr := C.GoString(localPath)
+    urlStr := C.GoString(ftpUrl)
+    if pathStr == "" {
+        return C.int(ErrMissingPath)
     }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return C.int(ErrConnectionFailed)
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrInitialRead)
+    var d ftp.Digests
+    if err := ftp.UploadFTPFile(pathStr, urlStr, ftp.WithDigests(&d)); err != nil {
+        return errorCode(err)
     }
+    storeDigests(digests, d)
+    return C.int(0)
+}
 
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return C.int(ErrUserSend)
+func storeDigests(out **C.char, d ftp.Digests) {
+    if out == nil {
+        return
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return C.int(ErrUserAuth)
+    data, err := json.Marshal(d)
+    if err != nil {
+        return
     }
+    *out = C.CString(string(data))
+}
 
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return C.int(ErrPassSend)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return C.int(ErrPassAuth)
-    }
+// batchSpec es el JSON aceptado por SubmitFTPBatch.
+type batchSpec struct {
+    Concurrency int            `json:"concurrency"`
+    Transfers   []ftp.Transfer `json:"transfers"`
+}
 
-    if _, err = fmt.Fprintf(conn, "TYPE I\r\n"); err != nil {
-        return C.int(ErrTypeCommand)
-    }
-    conn.Read(buf[:])
+var (
+    batchMu   sync.Mutex
+    batches   = make(map[int]*ftp.TransferQueue)
+    batchNext = 1
+)
 
-    if _, err = fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return C.int(ErrPasvMode)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrPasvMode)
+// SubmitFTPBatch inicia un lote de transferencias descrito en JSON:
+// {"concurrency": 4, "transfers": [{"source": "...", "destination": "..."}]}.
+// Retorna el id del lote (mayor que 0) o un código de error.
+//
+//export SubmitFTPBatch
+func SubmitFTPBatch(jsonSpec *C.char) C.int {
+    specStr := C.GoString(jsonSpec)
+    if specStr == "" {
+        return C.int(ErrEmptyData)
     }
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return C.int(ErrPasvMode)
+    var spec batchSpec
+    if err := json.Unmarshal([]byte(specStr), &spec); err != nil || len(spec.Transfers) == 0 {
+        return C.int(ErrInvalidOption)
     }
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return C.int(ErrConnectionFailed)
+    queue := ftp.NewTransferQueue(spec.Concurrency)
+    for _, t := range spec.Transfers {
+        queue.Add(t)
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
 
-    if _, err = fmt.Fprintf(conn, "STOR %s\r\n", path); err != nil {
-        return C.int(ErrStorCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return C.int(ErrDataTransfer)
-    }
+    batchMu.Lock()
+    id := batchNext
+    batchNext++
+    batches[id] = queue
+    batchMu.Unlock()
 
-    _, err = io.Copy(dataConn, bytes.NewReader(data))
-    if err != nil {
-        return C.int(ErrDataTransfer)
-    }
-    dataConn.Close()
-
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return C.int(ErrTransferConfirm)
-    }
-
-    return C.int(0) // Success
+    // Liberar el pool propio del lote al terminar
+    go queue.Close()
+    return C.int(id)
 }
 
-//export PutFTPText
-func PutFTPText(textData, ftpUrl *C.char) C.int {
-    textStr := C.GoString(textData)
-    urlStr := C.GoString(ftpUrl)
-    if textStr == "" {
-        return C.int(ErrEmptyData)
-    }
-    if urlStr == "" {
-        return C.int(ErrEmptyURL)
-    }
-
-    if isSFTP(urlStr) {
-        err := PutSFTPText(textStr, urlStr)
-        if err != nil {
-            return C.int(ErrSftpOperation)
-        }
-        return C.int(0)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil {
-        return C.int(ErrEmptyURL)
-    }
-    if u.Scheme != "ftp" {
-        return C.int(ErrInvalidScheme)
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return C.int(ErrMissingHostUser)
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return C.int(ErrConnectionFailed)
+// PollFTPBatch retorna el estado del lote en JSON, o NULL si el id no existe.
+//
+//export PollFTPBatch
+func PollFTPBatch(id C.int) *C.char {
+    batchMu.Lock()
+    queue := batches[int(id)]
+    batchMu.Unlock()
+    if queue == nil {
+        return nil
     }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+    data, err := json.Marshal(queue.Report())
     if err != nil {
-        return C.int(ErrInitialRead)
-    }
-
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return C.int(ErrUserSend)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return C.int(ErrUserAuth)
-    }
-
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return C.int(ErrPassSend)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return C.int(ErrPassAuth)
-    }
-
-    if _, err = fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return C.int(ErrAsciiMode)
+        return nil
     }
-    conn.Read(buf[:])
+    return C.CString(string(data))
+}
 
-    if _, err = fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return C.int(ErrPasvMode)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrPasvMode)
-    }
+// ReleaseFTPBatch olvida un lote terminado; retorna 1 si aún está en curso.
+//
+//export ReleaseFTPBatch
+func ReleaseFTPBatch(id C.int) C.int {
+    batchMu.Lock()
+    defer batchMu.Unlock()
+    queue := batches[int(id)]
+    if queue == nil {
+        return C.int(ErrInvalidOption)
+    }
+    if !queue.Report().Finished {
+        return C.int(1)
+    }
+    delete(batches, int(id))
+    return C.int(0)
+}
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return C.int(ErrPasvMode)
-    }
+// asyncJob es una operación lanzada con StartFTPGet, StartFTPPut o
+// StartFTPList. code y result solo son válidos una vez cerrado done.
+type asyncJob struct {
+    cancel context.CancelFunc
+    done   chan struct{}
+    code   C.int
+    result *string
+}
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return C.int(ErrConnectionFailed)
-    }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
+var (
+    jobMu   sync.Mutex
+    jobs    = make(map[int]*asyncJob)
+    jobNext = 1
+)
 
-    if _, err = fmt.Fprintf(conn, "STOR %s\r\n", path); err != nil {
-        return C.int(ErrStorCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return C.int(ErrDataTransfer)
-    }
+// startJob ejecuta op en una goroutine y retorna el handle del trabajo.
+func startJob(op func(ctx context.Context) (*string, error)) C.int {
+    ctx, cancel := context.WithCancel(context.Background())
+    job := &asyncJob{cancel: cancel, done: make(chan struct{})}
+
+    jobMu.Lock()
+    id := jobNext
+    jobNext++
+    jobs[id] = job
+    jobMu.Unlock()
+
+    go func() {
+        defer cancel()
+        result, err := op(ctx)
+        job.code = errorCode(err)
+        if err == nil {
+            job.result = result
+        }
+        close(job.done)
+    }()
+    return C.int(id)
+}
 
-    normalizedText := strings.ReplaceAll(textStr, "\n", "\r\n")
-    _, err = fmt.Fprintf(dataConn, normalizedText)
-    if err != nil {
-        return C.int(ErrDataTransfer)
-    }
-    dataConn.Close()
+func lookupJob(handle C.int) *asyncJob {
+    jobMu.Lock()
+    defer jobMu.Unlock()
+    return jobs[int(handle)]
+}
 
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return C.int(ErrTransferConfirm)
+// jobStatus retorna 1 si el trabajo sigue en curso, 0 si terminó bien o su
+// código de error.
+func jobStatus(job *asyncJob) C.int {
+    select {
+    case <-job.done:
+        return job.code
+    default:
+        return C.int(1)
     }
-
-    return C.int(0) // Success
 }
 
-//export CreateFTPDir
-func CreateFTPDir(ftpUrl *C.char) C.int {
+// StartFTPGet inicia en segundo plano la descarga de GetFTPFile. Retorna el
+// handle del trabajo (mayor que 0) o un código de error; FTPJobResult da el
+// contenido en base64.
+//
+//export StartFTPGet
+func StartFTPGet(ftpUrl *C.char) C.int {
     urlStr := C.GoString(ftpUrl)
     if urlStr == "" {
         return C.int(ErrEmptyURL)
     }
 
-    if isSFTP(urlStr) {
-        err := CreateSFTPDir(urlStr)
+    return startJob(func(ctx context.Context) (*string, error) {
+        data, err := ftp.GetFTPBytes(urlStr, ftp.WithContext(ctx))
         if err != nil {
-            // Handle specific error types if needed
-            return C.int(ErrSftpOperation)
+            return nil, err
         }
-        return C.int(0)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil {
-        return C.int(ErrEmptyURL)
-    }
-    if u.Scheme != "ftp" {
-        return C.int(ErrInvalidScheme)
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := strings.TrimPrefix(u.Path, "/")
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return C.int(ErrMissingHostUser)
-    }
-
-    if path == "" {
-        return C.int(ErrMissingPath)
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return C.int(ErrConnectionFailed)
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrInitialRead)
-    }
-
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return C.int(ErrUserSend)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return C.int(ErrUserAuth)
-    }
-
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return C.int(ErrPassSend)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return C.int(ErrPassAuth)
-    }
-
-    if _, err = fmt.Fprintf(conn, "SIZE %s\r\n", path); err != nil {
-        return C.int(ErrSizeCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrSizeResponse)
-    }
-    sizeResp := string(buf[:n])
-    if strings.HasPrefix(sizeResp, "213") {
-        return C.int(ErrFileConflict)
-    }
+        encoded := base64.StdEncoding.EncodeToString(data)
+        return &encoded, nil
+    })
+}
 
-    if _, err = fmt.Fprintf(conn, "CWD %s\r\n", path); err != nil {
-        return C.int(ErrCwdCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrCwdResponse)
+// StartFTPPut inicia en segundo plano la subida de PutFTPFile.
+//
+//export StartFTPPut
+func StartFTPPut(base64Data, ftpUrl *C.char) C.int {
+    base64Str := C.GoString(base64Data)
+    urlStr := C.GoString(ftpUrl)
+    if base64Str == "" {
+        return C.int(ErrEmptyData)
     }
-    cwdResp := string(buf[:n])
-    if strings.HasPrefix(cwdResp, "250") {
-        // Volver al directorio anterior
-        _, _ = fmt.Fprintf(conn, "CDUP\r\n")
-        return C.int(1) // Ya existe como directorio
+    if urlStr == "" {
+        return C.int(ErrEmptyURL)
     }
 
-    if _, err = fmt.Fprintf(conn, "MKD %s\r\n", path); err != nil {
-        return C.int(ErrMkdirFailed)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return C.int(ErrMkdirResponse)
-    }
-    resp := string(buf[:n])
-    if !strings.HasPrefix(resp, "257") {
-        return C.int(ErrMkdirFailed)
+    if _, err := base64.StdEncoding.DecodeString(base64Str); err != nil {
+        return C.int(-3) // Error decodificando base64
     }
 
-    return C.int(0) // Success
+    return startJob(func(ctx context.Context) (*string, error) {
+        return nil, ftp.PutFTPFile(base64Str, urlStr, ftp.WithContext(ctx))
+    })
 }
 
-//export ListFTPFiles
-func ListFTPFiles(dirPath *C.char) **C.char {
+// StartFTPList inicia en segundo plano el listado de ListFTPFiles;
+// FTPJobResult da los nombres como arreglo JSON.
+//
+//export StartFTPList
+func StartFTPList(dirPath *C.char) C.int {
     urlStr := C.GoString(dirPath)
     if urlStr == "" {
-        return nil
+        return C.int(ErrEmptyURL)
     }
 
-    if isSFTP(urlStr) {
-        
-        fileNames := ListSFTPFiles(urlStr)
-        if len(fileNames) == 0 {
-            return nil
+    return startJob(func(ctx context.Context) (*string, error) {
+        files, err := ftp.ListFTPDir(urlStr, ftp.WithContext(ctx))
+        if err != nil {
+            return nil, err
         }
-
-        // Allocate space for the array plus one extra for NULL terminator
-        cArray := C.malloc(C.size_t(len(fileNames)+1) * C.size_t(unsafe.Sizeof(uintptr(0))))
-        if cArray == nil {
-            return nil
+        if files == nil {
+            files = []string{}
         }
-        goArray := (*[1<<30 - 1]*C.char)(unsafe.Pointer(cArray))[:len(fileNames)+1:len(fileNames)+1]
-        for i, file := range fileNames {
-            goArray[i] = C.CString(file)
+        data, err := json.Marshal(files)
+        if err != nil {
+            return nil, err
         }
-        goArray[len(fileNames)] = nil // NULL terminator
-        return (**C.char)(cArray)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(urlStr)
-    if err != nil || u.Scheme != "ftp" {
-        return nil
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return nil
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return nil
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
-        return nil
-    }
-
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return nil
-    }
-
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return nil
-    }
-
-    if _, err := fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return nil
-    }
-    conn.Read(buf[:])
-
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return nil
-    }
-
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return nil
-    }
-
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return nil
-    }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
-
-    if _, err := fmt.Fprintf(conn, "LIST %s\r\n", path); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return nil
-    }
+        list := string(data)
+        return &list, nil
+    })
+}
 
-    var buffer bytes.Buffer
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return nil
+// FTPJobStatus retorna 1 si el trabajo sigue en curso, 0 si terminó con
+// éxito o el código de error con el que falló.
+//
+//export FTPJobStatus
+func FTPJobStatus(handle C.int) C.int {
+    job := lookupJob(handle)
+    if job == nil {
+        return C.int(ErrInvalidOption)
     }
+    return jobStatus(job)
+}
 
-    dataConn.Close()
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return nil
+// FTPJobWait espera como mucho timeoutMs milisegundos (negativo sin límite)
+// a que termine el trabajo y retorna su estado como FTPJobStatus.
+//
+//export FTPJobWait
+func FTPJobWait(handle, timeoutMs C.int) C.int {
+    job := lookupJob(handle)
+    if job == nil {
+        return C.int(ErrInvalidOption)
     }
 
-    lines := strings.Split(buffer.String(), "\n")
-    var files []string
-    for _, line := range lines {
-        line = strings.TrimSpace(line)
-        if line == "" {
-            continue
-        }
-        parts := strings.Fields(line)
-        if len(parts) > 0 {
-            files = append(files, parts[len(parts)-1])
-        }
+    if timeoutMs < 0 {
+        <-job.done
+        return job.code
     }
-
-    if len(files) == 0 {
-        return nil
+    timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+    defer timer.Stop()
+    select {
+    case <-job.done:
+    case <-timer.C:
     }
+    return jobStatus(job)
+}
 
-    // Allocate space for the array plus one extra for NULL terminator
-    cArray := C.malloc(C.size_t(len(files)+1) * C.size_t(unsafe.Sizeof(uintptr(0))))
-    if cArray == nil {
+// FTPJobResult retorna el resultado de un trabajo terminado con éxito (base64
+// para StartFTPGet, JSON para StartFTPList), o NULL si no lo hay. El llamador
+// debe liberarlo con free.
+//
+//export FTPJobResult
+func FTPJobResult(handle C.int) *C.char {
+    job := lookupJob(handle)
+    if job == nil || jobStatus(job) != 0 || job.result == nil {
         return nil
     }
-    goArray := (*[1<<30 - 1]*C.char)(unsafe.Pointer(cArray))[:len(files)+1:len(files)+1]
-    for i, file := range files {
-        goArray[i] = C.CString(file)
-    }
-    goArray[len(files)] = nil // NULL terminator
-    return (**C.char)(cArray)
+    return C.CString(*job.result)
 }
 
-//export FreeFTPList
-func FreeFTPList(arr **C.char) {
-    if arr == nil {
-        return
-    }
-    for i := 0; ; i++ {
-        p := *(**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(arr)) + uintptr(i)*unsafe.Sizeof(*arr)))
-        if p == nil {
-            break
-        }
-        C.free(unsafe.Pointer(p))
-    }
-    C.free(unsafe.Pointer(arr))
+// FTPJobCancel cancela el trabajo cerrando sus conexiones; termina con
+// ErrCanceled si no había acabado ya.
+//
+//export FTPJobCancel
+func FTPJobCancel(handle C.int) C.int {
+    job := lookupJob(handle)
+    if job == nil {
+        return C.int(ErrInvalidOption)
+    }
+    job.cancel()
+    return C.int(0)
 }
 
-
-
-
-
-
-
-func GetSFTPFile(ftpUrl string) string {
-    if ftpUrl == "" {
-        return ""
-    }
-
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return ""
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return ""
-    }
-
-    file, err := client.Open(u.Path)
-    if err != nil {
-        return ""
-    }
-    defer file.Close()
-
-    limitedReader := &io.LimitedReader{R: file, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return ""
-    }
-
-    if buffer.Len() == 0 {
-        return ""
-    }
-
-    return base64.StdEncoding.EncodeToString(buffer.Bytes())
+// ReleaseFTPJob olvida un trabajo terminado; retorna 1 si aún está en curso.
+//
+//export ReleaseFTPJob
+func ReleaseFTPJob(handle C.int) C.int {
+    jobMu.Lock()
+    defer jobMu.Unlock()
+    job := jobs[int(handle)]
+    if job == nil {
+        return C.int(ErrInvalidOption)
+    }
+    if jobStatus(job) == 1 {
+        return C.int(1)
+    }
+    delete(jobs, int(handle))
+    return C.int(0)
 }
 
-func GetSFTPText(ftpUrl string) string {
-    if ftpUrl == "" {
-        return ""
-    }
-
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return ""
+// SetSFTPTuning ajusta las transferencias SFTP: concurrency es el máximo de
+// peticiones simultáneas por archivo (1 secuencial, 0 valor por defecto) y
+// packetSize el tamaño de paquete (0 valor por defecto, 32768).
+//
+//export SetSFTPTuning
+func SetSFTPTuning(concurrency, packetSize C.int) C.int {
+    if concurrency < 0 || packetSize < 0 {
+        return C.int(ErrInvalidOption)
     }
-    defer client.Close()
-    defer conn.Close()
 
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return ""
-    }
-
-    file, err := client.Open(u.Path)
-    if err != nil {
-        return ""
-    }
-    defer file.Close()
-
-    limitedReader := &io.LimitedReader{R: file, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return ""
-    }
-
-    if buffer.Len() == 0 {
-        return ""
-    }
-
-    text := buffer.String()
-    text = strings.ReplaceAll(text, "\r\n", "\n")
-    return strings.TrimSpace(text)
+    ftp.SetSFTPTuning(ftp.SFTPTuning{Concurrency: int(concurrency), PacketSize: int(packetSize)})
+    return C.int(0)
 }
 
-func PutSFTPFile(base64Data, ftpUrl string) error {
-    if base64Data == "" {
-        return fmt.Errorf("error code %d: datos vacíos", ErrEmptyData)
-    }
-    if ftpUrl == "" {
-        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
-    }
-
-    data, err := base64.StdEncoding.DecodeString(base64Data)
-    if err != nil {
-        return fmt.Errorf("error decodificando base64: %v", err)
+// SetFTPCredentials registra en memoria el usuario y la contraseña de host
+// ("servidor" o "servidor:puerto") para las URLs sin contraseña, de modo que
+// no aparezcan en la URL. password NULL o "" elimina el registro.
+//
+//export SetFTPCredentials
+func SetFTPCredentials(host, user, password *C.char) C.int {
+    if host == nil {
+        return C.int(ErrMissingHostUser)
     }
-
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return err
+    var u, p string
+    if user != nil {
+        u = C.GoString(user)
     }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return err
+    if password != nil {
+        p = C.GoString(password)
     }
-
-    dir := filepath.Dir(u.Path)
-    if dir != "." {
-        if err := client.MkdirAll(dir); err != nil {
-            return fmt.Errorf("error code %d: failed to create directories: %v", ErrSftpOperation, err)
-        }
+    if err := ftp.SetFTPCredentials(C.GoString(host), u, p); err != nil {
+        return errorCode(err)
     }
-
-    file, err := client.Create(u.Path)
-    if err != nil {
-        return fmt.Errorf("error code %d: failed to create file: %v", ErrSftpOperation, err)
-    }
-    defer file.Close()
-
-    if _, err := file.Write(data); err != nil {
-        return fmt.Errorf("error code %d: failed to write file: %v", ErrSftpOperation, err)
-    }
-
-    return nil
+    return C.int(0)
 }
 
-func PutSFTPText(textData, ftpUrl string) error {
-    if textData == "" {
-        return fmt.Errorf("error code %d: texto vacío", ErrEmptyData)
-    }
-    if ftpUrl == "" {
-        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
-    }
-
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return err
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return err
-    }
-
-    dir := filepath.Dir(u.Path)
-    if dir != "." {
-        if err := client.MkdirAll(dir); err != nil {
-            return fmt.Errorf("error code %d: failed to create directories: %v", ErrSftpOperation, err)
-        }
-    }
-
-    file, err := client.Create(u.Path)
-    if err != nil {
-        return fmt.Errorf("error code %d: failed to create file: %v", ErrSftpOperation, err)
+// LoadFTPProfiles carga los perfiles de conexión de path, un archivo YAML,
+// JSON o TOML, y sustituye a los cargados antes. Una URL usa un perfil si su
+// host es el nombre del perfil (ftp://@socio/ruta) o con ?profile=nombre.
+//
+//export LoadFTPProfiles
+func LoadFTPProfiles(path *C.char) C.int {
+    if path == nil {
+        return C.int(ErrMissingPath)
     }
-    defer file.Close()
-
-    normalizedText := strings.ReplaceAll(strings.ReplaceAll(textData, "\r\n", "\n"), "\n", "\r\n")
-    if _, err := fmt.Fprint(file, normalizedText); err != nil {
-        return fmt.Errorf("error code %d: failed to write file: %v", ErrSftpOperation, err)
+    if err := ftp.LoadFTPProfiles(C.GoString(path)); err != nil {
+        return errorCode(err)
     }
-
-    return nil
+    return C.int(0)
 }
 
-func CreateSFTPDir(ftpUrl string) error {
-    if ftpUrl == "" {
-        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
-    }
-
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return err
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return err
-    }
-
-    path := strings.TrimPrefix(u.Path, "/")
-    if path == "" {
-        return fmt.Errorf("error code %d: falta path del directorio", ErrMissingPath)
-    }
-
-    if stat, err := client.Stat(path); err == nil {
-        if !stat.IsDir() {
-            return fmt.Errorf("error code %d: ya existe como archivo (conflicto)", ErrFileConflict)
+// SetFTPRetryPolicy configura los reintentos de todas las operaciones.
+// retryOn es una lista separada por comas de códigos Err* (-6), respuestas
+// FTP (421) o clases de respuesta (4xx); NULL o "" usa la lista por defecto.
+// maxAttempts <= 1 desactiva los reintentos.
+//
+//export SetFTPRetryPolicy
+func SetFTPRetryPolicy(maxAttempts, initialBackoffMs, maxBackoffMs C.int, jitter C.double, retryOn *C.char) C.int {
+    if maxAttempts < 0 || initialBackoffMs < 0 || maxBackoffMs < 0 || jitter < 0 || jitter > 1 {
+        return C.int(ErrInvalidOption)
+    }
+
+    policy := ftp.DefaultRetryPolicy()
+    policy.MaxAttempts = int(maxAttempts)
+    policy.InitialBackoff = time.Duration(initialBackoffMs) * time.Millisecond
+    policy.MaxBackoff = time.Duration(maxBackoffMs) * time.Millisecond
+    policy.Jitter = float64(jitter)
+
+    if spec := strings.TrimSpace(C.GoString(retryOn)); spec != "" {
+        policy.RetryableErrors = nil
+        policy.RetryableReplies = nil
+        for _, item := range strings.Split(spec, ",") {
+            item = strings.ToLower(strings.TrimSpace(item))
+            if len(item) == 3 && strings.HasSuffix(item, "xx") && item[0] >= '1' && item[0] <= '5' {
+                policy.RetryableReplies = append(policy.RetryableReplies, int(item[0]-'0'))
+                continue
+            }
+            n, err := strconv.Atoi(item)
+            switch {
+            case err == nil && n < 0:
+                policy.RetryableErrors = append(policy.RetryableErrors, n)
+            case err == nil && n >= 100 && n <= 599:
+                policy.RetryableReplies = append(policy.RetryableReplies, n)
+            default:
+                return C.int(ErrInvalidOption)
+            }
         }
-        return nil
-    }
-
-    if err := client.MkdirAll(path); err != nil {
-        return fmt.Errorf("error code %d: error creando directorio: %v", ErrMkdirFailed, err)
-    }
-
-    return nil
-}
-
-func ListSFTPFiles(dirPath string) []string {
-    if dirPath == "" {
-        return nil
-    }
-
-    client, conn, err := createSFTPClient(dirPath)
-    if err != nil {
-        return nil
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(dirPath)
-    if err != nil {
-        return nil
-    }
-
-    files, err := client.ReadDir(u.Path)
-    if err != nil {
-        return nil
-    }
-
-    var fileNames []string
-    for _, file := range files {
-        fileNames = append(fileNames, file.Name())
     }
 
-    return fileNames
+    ftp.SetRetryPolicy(policy)
+    return C.int(0)
 }
 
 
@@ -3,8 +3,12 @@ module github.com/IngenieroRicardo/ftp
 go 1.24.1
 
 require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/klauspost/compress v1.18.0
 	github.com/pkg/sftp v1.13.9
 	golang.org/x/crypto v0.39.0
+	golang.org/x/term v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
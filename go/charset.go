@@ -0,0 +1,85 @@
+package ftp
+
+import (
+    "fmt"
+    "strings"
+    "unicode/utf8"
+)
+
+// Los servidores antiguos de Windows usan una página de códigos en lugar de
+// UTF-8 para los nombres. Con ?charset= o el campo Charset del perfil los
+// comandos se codifican y las respuestas y listados se decodifican.
+
+// cp1252 son los caracteres de Windows-1252 entre 0x80 y 0x9F; el resto
+// coincide con Latin-1. Los huecos sin asignar se dejan a 0.
+var cp1252 = [32]rune{
+    '€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+    0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// charsetName normaliza el nombre de una codificación; "" es UTF-8.
+func charsetName(name string) (string, bool) {
+    switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+    case "", "utf-8", "utf8":
+        return "", true
+    case "latin1", "latin-1", "iso-8859-1":
+        return "latin1", true
+    case "cp1252", "windows-1252":
+        return "cp1252", true
+    }
+    return "", false
+}
+
+// encodeText pasa text de UTF-8 a charset.
+func encodeText(charset, text string) (string, error) {
+    if charset == "" {
+        return text, nil
+    }
+    var b strings.Builder
+    for _, r := range text {
+        switch {
+        case r < 0x80 || (r < 0x100 && (charset == "latin1" || r >= 0xA0)):
+            b.WriteByte(byte(r))
+        default:
+            c, ok := encodeCP1252(charset, r)
+            if !ok {
+                return "", fmt.Errorf("%q no existe en %s", r, charset)
+            }
+            b.WriteByte(c)
+        }
+    }
+    return b.String(), nil
+}
+
+func encodeCP1252(charset string, r rune) (byte, bool) {
+    if charset != "cp1252" {
+        return 0, false
+    }
+    for i, c := range cp1252 {
+        if c != 0 && c == r {
+            return byte(0x80 + i), true
+        }
+    }
+    return 0, false
+}
+
+// decodeText pasa text de charset a UTF-8.
+func decodeText(charset, text string) string {
+    if charset == "" {
+        return text
+    }
+    var b strings.Builder
+    for i := 0; i < len(text); i++ {
+        c := text[i]
+        r := rune(c)
+        if charset == "cp1252" && c >= 0x80 && c < 0xA0 && cp1252[c-0x80] != 0 {
+            r = cp1252[c-0x80]
+        }
+        if r < utf8.RuneSelf {
+            b.WriteByte(c)
+        } else {
+            b.WriteRune(r)
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,975 @@
+package ftp
+
+import (
+    "bufio"
+    "compress/zlib"
+    "context"
+    "crypto/tls"
+    "fmt"
+    "io"
+    "net"
+    "net/textproto"
+    "net/url"
+    "path"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ftpSession es una conexión de control FTP ya autenticada.
+type ftpSession struct {
+    conn     net.Conn
+    text     *textproto.Conn
+    ctx      context.Context // contexto de la operación que usa la sesión
+    settings connSettings
+    tls      *tls.Config // nil sin cifrado; también protege los datos
+    // features son las extensiones anunciadas con FEAT y sus parámetros;
+    // nil si el servidor no admite FEAT.
+    features map[string]string
+    hash     string // algoritmo activo de HASH
+    deflate  bool   // MODE Z activo: los datos van comprimidos con zlib
+    noEPSV   bool   // el servidor anuncia EPSV pero lo rechaza: se usa PASV
+}
+
+// idleConn renueva el plazo de la conexión en cada lectura o escritura, de
+// modo que el timeout limita la inactividad y no la transferencia completa.
+// stop anula el cierre programado al cancelarse el contexto.
+type idleConn struct {
+    net.Conn
+    stop    func() bool
+    timeout time.Duration
+}
+
+func (c idleConn) Close() error {
+    c.stop()
+    return c.Conn.Close()
+}
+
+func (c idleConn) Read(p []byte) (int, error) {
+    c.Conn.SetDeadline(time.Now().Add(c.timeout))
+    return c.Conn.Read(p)
+}
+
+func (c idleConn) Write(p []byte) (int, error) {
+    c.Conn.SetDeadline(time.Now().Add(c.timeout))
+    return c.Conn.Write(p)
+}
+
+// dialFTP abre la conexión de control, lee el saludo y se autentica con las
+// credenciales de la URL. Con TLS cifra la conexión de control antes de
+// enviar las credenciales y las de datos con PROT P.
+func dialFTP(ctx context.Context, u *url.URL) (*ftpSession, error) {
+    user := u.User.Username()
+    pass, _ := u.User.Password()
+    if u.Host == "" || user == "" {
+        return nil, errorf(ErrMissingHostUser, "falta host o usuario")
+    }
+    settings := settingsFor(u)
+
+    host := u.Host
+    if u.Port() == "" {
+        port := "21"
+        if settings.tls == "implicit" {
+            port = "990"
+        }
+        host = net.JoinHostPort(u.Hostname(), port)
+    }
+
+    dialer := net.Dialer{Timeout: settings.timeout}
+    conn, err := dialer.DialContext(ctx, "tcp", host)
+    if err != nil {
+        return nil, wrapError(ErrConnectionFailed, err, "conexión fallida")
+    }
+    s := &ftpSession{conn: conn, text: textproto.NewConn(conn), ctx: ctx, settings: settings}
+    stop := context.AfterFunc(ctx, func() { conn.Close() })
+    defer stop()
+
+    if settings.tls != "" {
+        s.tls = &tls.Config{
+            ServerName:         u.Hostname(),
+            InsecureSkipVerify: settings.insecure,
+            // Muchos servidores exigen reanudar la sesión TLS del control
+            // en las conexiones de datos
+            ClientSessionCache: tls.NewLRUClientSessionCache(0),
+        }
+    }
+    if settings.tls == "implicit" {
+        if err := s.startTLS(); err != nil {
+            s.conn.Close()
+            return nil, err
+        }
+    }
+
+    code, msg, err := s.reply()
+    if err != nil {
+        s.conn.Close()
+        return nil, wrapError(ErrInitialRead, err, "lectura inicial fallida")
+    }
+    if code/100 != 2 {
+        s.conn.Close()
+        return nil, replyError(ErrConnectionFailed, code, msg, "servidor no disponible")
+    }
+
+    if settings.tls == "explicit" {
+        code, msg, err := s.cmd(ErrConnectionFailed, "AUTH TLS")
+        if err == nil && code != 234 {
+            err = replyError(ErrConnectionFailed, code, msg, "el servidor no admite AUTH TLS")
+        }
+        if err == nil {
+            err = s.startTLS()
+        }
+        if err != nil {
+            s.conn.Close()
+            return nil, err
+        }
+    }
+
+    if err := s.login(user, pass); err != nil {
+        s.conn.Close()
+        return nil, err
+    }
+    if err := s.feat(); err != nil {
+        s.conn.Close()
+        return nil, err
+    }
+    if settings.charset == "" && s.supports("UTF8") {
+        // Muchos servidores solo envían UTF-8 si se les pide; los que no
+        // lo admiten responden con un error que se ignora
+        if _, _, err := s.cmd(ErrConnectionFailed, "OPTS UTF8 ON"); err != nil {
+            s.conn.Close()
+            return nil, err
+        }
+    }
+    if s.tls != nil {
+        if err := s.protect(); err != nil {
+            s.conn.Close()
+            return nil, err
+        }
+    }
+    return s, nil
+}
+
+// startTLS negocia TLS sobre la conexión de control.
+func (s *ftpSession) startTLS() error {
+    conn := tls.Client(s.conn, s.tls)
+    conn.SetDeadline(time.Now().Add(s.settings.timeout))
+    if err := conn.HandshakeContext(s.ctx); err != nil {
+        return wrapError(ErrConnectionFailed, err, "error negociando TLS")
+    }
+    s.conn = conn
+    s.text = textproto.NewConn(conn)
+    return nil
+}
+
+// protect pide cifrar las conexiones de datos (RFC 4217).
+func (s *ftpSession) protect() error {
+    for _, command := range []string{"PBSZ 0", "PROT P"} {
+        code, msg, err := s.cmd(ErrConnectionFailed, "%s", command)
+        if err != nil {
+            return err
+        }
+        if code/100 != 2 {
+            return replyError(ErrConnectionFailed, code, msg, "el servidor no admite "+command)
+        }
+    }
+    return nil
+}
+
+// send envía un comando en la codificación del servidor. Un salto de línea
+// en los argumentos añadiría otro comando, así que se rechaza.
+func (s *ftpSession) send(format string, args ...interface{}) error {
+    line := fmt.Sprintf(format, args...)
+    if strings.ContainsAny(line, "\r\n\x00") {
+        return errorf(ErrInvalidPath, "comando con caracteres de control")
+    }
+    line, err := encodeText(s.settings.charset, line)
+    if err != nil {
+        return wrapError(ErrInvalidPath, err, "nombre no representable")
+    }
+    s.conn.SetDeadline(time.Now().Add(s.settings.timeout))
+    return s.text.PrintfLine("%s", line)
+}
+
+func (s *ftpSession) reply() (int, string, error) {
+    s.conn.SetDeadline(time.Now().Add(s.settings.timeout))
+    code, msg, err := s.text.ReadResponse(0)
+    return code, decodeText(s.settings.charset, msg), err
+}
+
+// cmd envía un comando y devuelve la respuesta; los fallos de envío y de
+// lectura se reportan con el mismo código.
+func (s *ftpSession) cmd(errCode int, format string, args ...interface{}) (int, string, error) {
+    line := fmt.Sprintf(format, args...)
+    verb, _, _ := strings.Cut(line, " ")
+    if err := s.send("%s", line); err != nil {
+        return 0, "", wrapError(errCode, err, "error enviando comando "+verb)
+    }
+    code, msg, err := s.reply()
+    if err != nil {
+        return 0, "", wrapError(errCode, err, "error leyendo respuesta "+verb)
+    }
+    return code, msg, nil
+}
+
+func (s *ftpSession) login(user, pass string) error {
+    if err := s.send("USER %s", user); err != nil {
+        return wrapError(ErrUserSend, err, "error enviando usuario")
+    }
+    code, msg, err := s.reply()
+    if err != nil {
+        return wrapError(ErrUserAuth, err, "autenticación de usuario fallida")
+    }
+    if code == 230 {
+        return nil
+    }
+    if code != 331 {
+        return replyError(ErrUserAuth, code, msg, "autenticación de usuario fallida")
+    }
+
+    if err := s.send("PASS %s", pass); err != nil {
+        return wrapError(ErrPassSend, err, "error enviando contraseña")
+    }
+    code, msg, err = s.reply()
+    if err != nil {
+        return wrapError(ErrPassAuth, err, "autenticación de contraseña fallida")
+    }
+    if code != 230 && code != 202 {
+        return replyError(ErrPassAuth, code, msg, "autenticación de contraseña fallida")
+    }
+    return nil
+}
+
+// feat pide las extensiones del servidor (RFC 2389). Un servidor sin FEAT
+// deja features a nil y las operaciones prueban los comandos.
+func (s *ftpSession) feat() error {
+    code, msg, err := s.cmd(ErrConnectionFailed, "FEAT")
+    if err != nil {
+        return err
+    }
+    if code != 211 {
+        return nil
+    }
+    s.features = map[string]string{}
+    for _, line := range strings.Split(msg, "\n") {
+        // Las extensiones van con sangría entre la primera y la última línea
+        if !strings.HasPrefix(line, " ") {
+            continue
+        }
+        name, params, _ := strings.Cut(strings.TrimSpace(line), " ")
+        if name != "" {
+            s.features[strings.ToUpper(name)] = params
+        }
+    }
+    return nil
+}
+
+// supports indica si se puede intentar la extensión name: el servidor la
+// anunció o no admite FEAT.
+func (s *ftpSession) supports(name string) bool {
+    if s.features == nil {
+        return true
+    }
+    _, ok := s.features[name]
+    return ok
+}
+
+// canResume indica si el servidor admite REST en modo stream.
+func (s *ftpSession) canResume() bool {
+    if s.features == nil {
+        return true
+    }
+    params, ok := s.features["REST"]
+    return ok && strings.EqualFold(params, "STREAM")
+}
+
+// setType cambia el tipo de transferencia: "I" binario o "A" texto.
+func (s *ftpSession) setType(t string) error {
+    errCode := ErrTypeCommand
+    if t == "A" {
+        errCode = ErrAsciiMode
+    }
+    code, msg, err := s.cmd(errCode, "TYPE %s", t)
+    if err != nil {
+        return err
+    }
+    if code/100 != 2 {
+        return replyError(errCode, code, msg, "error configurando tipo de transferencia")
+    }
+    return nil
+}
+
+// setMode activa o desactiva MODE Z, que comprime las conexiones de datos.
+// Si el servidor no lo admite se sigue en modo stream sin error.
+func (s *ftpSession) setMode(deflate bool) error {
+    if deflate == s.deflate {
+        return nil
+    }
+    if deflate && s.features != nil && !strings.EqualFold(s.features["MODE"], "Z") {
+        return nil
+    }
+    mode := "S"
+    if deflate {
+        mode = "Z"
+    }
+    code, msg, err := s.cmd(ErrTypeCommand, "MODE %s", mode)
+    if err != nil {
+        return err
+    }
+    if code/100 != 2 {
+        if deflate {
+            return nil
+        }
+        return replyError(ErrTypeCommand, code, msg, "error configurando modo de transferencia")
+    }
+    s.deflate = deflate
+    return nil
+}
+
+// dataReader devuelve lo que llega por la conexión de datos, descomprimido
+// si MODE Z está activo.
+func (s *ftpSession) dataReader(dataConn io.Reader) io.Reader {
+    if !s.deflate {
+        return dataConn
+    }
+    return &inflateReader{r: bufio.NewReader(dataConn)}
+}
+
+// inflateReader descomprime un flujo zlib de MODE Z. Algunos servidores no
+// envían nada para un archivo vacío.
+type inflateReader struct {
+    r  *bufio.Reader
+    zr io.ReadCloser
+}
+
+func (z *inflateReader) Read(p []byte) (int, error) {
+    if z.zr == nil {
+        if _, err := z.r.Peek(1); err != nil {
+            return 0, err
+        }
+        zr, err := zlib.NewReader(z.r)
+        if err != nil {
+            return 0, err
+        }
+        z.zr = zr
+    }
+    return z.zr.Read(p)
+}
+
+// copyData envía r por la conexión de datos, comprimido si MODE Z está
+// activo, y devuelve los bytes leídos de r.
+func (s *ftpSession) copyData(dataConn io.Writer, r io.Reader) (int64, error) {
+    if !s.deflate {
+        return io.Copy(dataConn, r)
+    }
+    zw := zlib.NewWriter(dataConn)
+    n, err := io.Copy(zw, r)
+    if err != nil {
+        return n, err
+    }
+    return n, zw.Close()
+}
+
+// openData prepara la conexión de datos de la siguiente transferencia, en
+// modo pasivo o activo según el perfil.
+func (s *ftpSession) openData() (io.ReadWriteCloser, error) {
+    if s.settings.active {
+        return s.openActive()
+    }
+    if _, ok := s.features["EPSV"]; ok && !s.noEPSV {
+        dataConn, err := s.openExtended()
+        // Tras NAT o cortafuegos antiguos EPSV puede fallar aunque se anuncie
+        if ReplyCode(err)/100 != 5 {
+            return dataConn, err
+        }
+        s.noEPSV = true
+    }
+    if err := s.send("PASV"); err != nil {
+        return nil, wrapError(ErrPasvMode, err, "error entrando en modo pasivo")
+    }
+    code, msg, err := s.reply()
+    if err != nil {
+        return nil, wrapError(ErrPasvMode, err, "error leyendo respuesta PASV")
+    }
+    if code != 227 {
+        return nil, replyError(ErrPasvMode, code, msg, "error entrando en modo pasivo")
+    }
+
+    dataAddr, err := parsePASV(msg)
+    if err != nil {
+        return nil, wrapError(ErrPasvMode, err, "error analizando modo pasivo")
+    }
+    // Muchos servidores tras NAT anuncian una IP privada o 0.0.0.0: se usa
+    // siempre el host de la conexión de control con el puerto anunciado
+    if _, port, err := net.SplitHostPort(dataAddr); err == nil {
+        if host, _, err := net.SplitHostPort(s.conn.RemoteAddr().String()); err == nil {
+            dataAddr = net.JoinHostPort(host, port)
+        }
+    }
+
+    dialer := net.Dialer{Timeout: s.settings.timeout}
+    dataConn, err := dialer.DialContext(s.ctx, "tcp", dataAddr)
+    if err != nil {
+        return nil, wrapError(ErrConnectionFailed, err, "error conexión de datos")
+    }
+    return s.wrapData(dataConn), nil
+}
+
+// openExtended abre la conexión de datos con EPSV (RFC 2428), que solo da
+// el puerto y funciona también en IPv6.
+func (s *ftpSession) openExtended() (io.ReadWriteCloser, error) {
+    code, msg, err := s.cmd(ErrPasvMode, "EPSV")
+    if err != nil {
+        return nil, err
+    }
+    if code != 229 {
+        return nil, replyError(ErrPasvMode, code, msg, "error entrando en modo pasivo extendido")
+    }
+    // 229 Entering Extended Passive Mode (|||6446|)
+    start := strings.Index(msg, "(")
+    end := strings.LastIndex(msg, ")")
+    if start == -1 || end < start {
+        return nil, errorf(ErrPasvMode, "formato EPSV inválido")
+    }
+    fields := strings.Split(msg[start+1:end], msg[start+1:start+2])
+    if len(fields) != 5 {
+        return nil, errorf(ErrPasvMode, "formato EPSV inválido")
+    }
+    port, err := strconv.Atoi(fields[3])
+    if err != nil || port <= 0 || port > 65535 {
+        return nil, errorf(ErrPasvMode, "puerto EPSV inválido")
+    }
+
+    host, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+    dialer := net.Dialer{Timeout: s.settings.timeout}
+    dataConn, err := dialer.DialContext(s.ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+    if err != nil {
+        return nil, wrapError(ErrConnectionFailed, err, "error conexión de datos")
+    }
+    return s.wrapData(dataConn), nil
+}
+
+// wrapData aplica a una conexión de datos el cifrado, el timeout de
+// inactividad y la cancelación del contexto.
+func (s *ftpSession) wrapData(conn net.Conn) net.Conn {
+    if s.tls != nil {
+        conn = tls.Client(conn, s.tls)
+    }
+    stop := context.AfterFunc(s.ctx, func() { conn.Close() })
+    return idleConn{Conn: conn, stop: stop, timeout: s.settings.timeout}
+}
+
+// openActive escucha en la IP local de la conexión de control y la anuncia
+// con PORT, o EPRT en IPv6. El servidor conecta tras RETR o STOR, así que la
+// conexión se acepta en la primera lectura o escritura.
+func (s *ftpSession) openActive() (io.ReadWriteCloser, error) {
+    local, _ := s.conn.LocalAddr().(*net.TCPAddr)
+    if local == nil {
+        return nil, errorf(ErrPasvMode, "dirección local desconocida")
+    }
+    l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local.IP})
+    if err != nil {
+        return nil, wrapError(ErrPasvMode, err, "error entrando en modo activo")
+    }
+    addr := l.Addr().(*net.TCPAddr)
+
+    var code int
+    var msg string
+    if ip := addr.IP.To4(); ip != nil {
+        code, msg, err = s.cmd(ErrPasvMode, "PORT %d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], addr.Port>>8, addr.Port&0xff)
+    } else {
+        code, msg, err = s.cmd(ErrPasvMode, "EPRT |2|%s|%d|", addr.IP, addr.Port)
+    }
+    if err == nil && code/100 != 2 {
+        err = replyError(ErrPasvMode, code, msg, "error entrando en modo activo")
+    }
+    if err != nil {
+        l.Close()
+        return nil, err
+    }
+    return &activeConn{s: s, l: l}, nil
+}
+
+// activeConn es la conexión de datos en modo activo.
+type activeConn struct {
+    s    *ftpSession
+    l    *net.TCPListener
+    once sync.Once
+    conn net.Conn
+    err  error
+}
+
+func (c *activeConn) accept() (net.Conn, error) {
+    c.once.Do(func() {
+        c.l.SetDeadline(time.Now().Add(c.s.settings.timeout))
+        stop := context.AfterFunc(c.s.ctx, func() { c.l.Close() })
+        conn, err := c.l.Accept()
+        stop()
+        c.l.Close()
+        if err != nil {
+            c.err = wrapError(ErrConnectionFailed, err, "error conexión de datos")
+            return
+        }
+        c.conn = c.s.wrapData(conn)
+    })
+    return c.conn, c.err
+}
+
+func (c *activeConn) Read(p []byte) (int, error) {
+    conn, err := c.accept()
+    if err != nil {
+        return 0, err
+    }
+    return conn.Read(p)
+}
+
+func (c *activeConn) Write(p []byte) (int, error) {
+    conn, err := c.accept()
+    if err != nil {
+        return 0, err
+    }
+    return conn.Write(p)
+}
+
+func (c *activeConn) Close() error {
+    c.l.Close()
+    if c.conn != nil {
+        return c.conn.Close()
+    }
+    return nil
+}
+
+// rest fija la posición desde la que continuará la siguiente transferencia.
+func (s *ftpSession) rest(offset int64) error {
+    code, msg, err := s.cmd(ErrDataTransfer, "REST %d", offset)
+    if err != nil {
+        return err
+    }
+    if code != 350 {
+        return replyError(ErrDataTransfer, code, msg, "el servidor no admite reanudar")
+    }
+    return nil
+}
+
+// finish espera la confirmación del servidor al cerrar una transferencia.
+func (s *ftpSession) finish() error {
+    code, msg, err := s.reply()
+    if err != nil {
+        return wrapError(ErrTransferConfirm, err, "error confirmando transferencia")
+    }
+    if code/100 != 2 {
+        return replyError(ErrTransferConfirm, code, msg, "error confirmando transferencia")
+    }
+    return nil
+}
+
+// retr descarga path en w a partir de offset, ya pedido con REST; falla si
+// el archivo supera limit bytes.
+func (s *ftpSession) retr(path string, w io.Writer, offset, limit int64) error {
+    dataConn, err := s.openData()
+    if err != nil {
+        return err
+    }
+    defer dataConn.Close()
+
+    code, msg, err := s.cmd(ErrDataTransfer, "RETR %s", path)
+    if err != nil {
+        return err
+    }
+    if code/100 != 1 {
+        return replyError(ErrDataTransfer, code, msg, "error iniciando descarga")
+    }
+
+    limitedReader := &io.LimitedReader{R: s.dataReader(dataConn), N: limit - offset}
+    if _, err := io.Copy(w, limitedReader); err != nil {
+        return wrapError(ErrDataTransfer, err, "error recibiendo datos")
+    }
+    if limitedReader.N <= 0 {
+        return errorf(ErrDataTransfer, "el archivo supera el límite de %d bytes", limit)
+    }
+    dataConn.Close()
+
+    return s.finish()
+}
+
+// stor sube el contenido de r a path y devuelve los bytes enviados, aunque
+// la transferencia falle.
+func (s *ftpSession) stor(path string, r io.Reader) (int64, error) {
+    return s.upload("STOR", path, r)
+}
+
+// upload envía r con verb: STOR reemplaza path y APPE añade al final.
+func (s *ftpSession) upload(verb, path string, r io.Reader) (int64, error) {
+    dataConn, err := s.openData()
+    if err != nil {
+        return 0, err
+    }
+    defer dataConn.Close()
+
+    if err := s.send("%s %s", verb, path); err != nil {
+        return 0, wrapError(ErrStorCommand, err, "error iniciando transferencia")
+    }
+    code, msg, err := s.reply()
+    if err != nil {
+        return 0, wrapError(ErrDataTransfer, err, "error preparando servidor")
+    }
+    if code/100 != 1 {
+        return 0, replyError(ErrDataTransfer, code, msg, "error preparando servidor")
+    }
+
+    n, err := s.copyData(dataConn, r)
+    if err != nil {
+        return n, wrapError(ErrDataTransfer, err, "error enviando datos")
+    }
+    dataConn.Close()
+
+    return n, s.finish()
+}
+
+// stou sube r con STOU desde el directorio de p, proponiendo su nombre si lo
+// tiene, y devuelve la ruta que asigna el servidor y los bytes enviados. La
+// ruta se conoce en cuanto llega la respuesta 150 aunque después falle la
+// transferencia.
+func (s *ftpSession) stou(p string, r io.Reader) (string, int64, error) {
+    dir, hint := path.Split(p)
+    if dir != "" {
+        cwd := s.pwd()
+        code, msg, err := s.cmd(ErrCwdCommand, "CWD %s", dir)
+        if err != nil {
+            return "", 0, err
+        }
+        if code != 250 {
+            return "", 0, replyError(ErrCwdResponse, code, msg, "error cambiando de directorio")
+        }
+        if cwd != "" {
+            defer s.cmd(ErrCwdCommand, "CWD %s", cwd)
+        }
+    }
+
+    dataConn, err := s.openData()
+    if err != nil {
+        return "", 0, err
+    }
+    defer dataConn.Close()
+
+    // El RFC 959 no prevé argumento; si el servidor lo rechaza se omite
+    command := strings.TrimSpace("STOU " + hint)
+    code, msg, err := s.cmd(ErrStorCommand, "%s", command)
+    if err == nil && hint != "" && (code == 500 || code == 501 || code == 502 || code == 504) {
+        code, msg, err = s.cmd(ErrStorCommand, "STOU")
+    }
+    if err != nil {
+        return "", 0, err
+    }
+    if code/100 != 1 {
+        return "", 0, replyError(ErrDataTransfer, code, msg, "error preparando servidor")
+    }
+    name := stouName(msg)
+
+    n, err := s.copyData(dataConn, r)
+    if err != nil {
+        return uniquePath(dir, name), n, wrapError(ErrDataTransfer, err, "error enviando datos")
+    }
+    dataConn.Close()
+
+    code, msg, err = s.reply()
+    if err != nil {
+        return uniquePath(dir, name), n, wrapError(ErrTransferConfirm, err, "error confirmando transferencia")
+    }
+    if code/100 != 2 {
+        return uniquePath(dir, name), n, replyError(ErrTransferConfirm, code, msg, "error confirmando transferencia")
+    }
+    if name == "" {
+        name = stouName(msg)
+    }
+    if name == "" {
+        return "", n, errorf(ErrDataTransfer, "el servidor no indicó el nombre asignado")
+    }
+    return uniquePath(dir, name), n, nil
+}
+
+// stouNames reconocen el nombre asignado en las respuestas de STOU:
+// "150 FILE: nombre" (RFC 1123), "226 Transfer complete (unique file
+// name:nombre)" y "150 Opening BINARY mode data connection for nombre."
+var stouNames = []*regexp.Regexp{
+    regexp.MustCompile(`(?im)FILE:\s*(.+?)\s*$`),
+    regexp.MustCompile(`(?i)unique file name:\s*([^)]+?)\s*\)`),
+    regexp.MustCompile(`(?im)data connection for (.+?)(?: \(\d+ bytes\))?\.?$`),
+}
+
+func stouName(msg string) string {
+    for _, re := range stouNames {
+        if m := re.FindStringSubmatch(msg); m != nil {
+            return m[1]
+        }
+    }
+    return ""
+}
+
+// uniquePath completa con dir el nombre relativo que da STOU.
+func uniquePath(dir, name string) string {
+    if name == "" || strings.HasPrefix(name, "/") {
+        return name
+    }
+    return path.Join(dir, name)
+}
+
+// size devuelve el tamaño de path según el comando SIZE.
+func (s *ftpSession) size(path string) (int64, error) {
+    code, msg, err := s.cmd(ErrSizeResponse, "SIZE %s", path)
+    if err != nil {
+        return 0, err
+    }
+    if code != 213 {
+        return 0, replyError(ErrSizeResponse, code, msg, "SIZE no disponible")
+    }
+    size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+    if err != nil {
+        return 0, wrapError(ErrSizeResponse, err, "respuesta SIZE inválida")
+    }
+    return size, nil
+}
+
+// list devuelve las líneas del listado de path con verb (LIST o MLSD).
+func (s *ftpSession) list(verb, path string) ([]string, error) {
+    // Los listados son cortos y no compensa comprimirlos
+    if err := s.setMode(false); err != nil {
+        return nil, err
+    }
+    dataConn, err := s.openData()
+    if err != nil {
+        return nil, err
+    }
+    defer dataConn.Close()
+
+    var code int
+    var msg string
+    if path != "" {
+        code, msg, err = s.cmd(ErrDataTransfer, "%s %s", verb, path)
+    } else {
+        code, msg, err = s.cmd(ErrDataTransfer, "%s", verb)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if code/100 != 1 {
+        return nil, replyError(ErrDataTransfer, code, msg, "error iniciando listado")
+    }
+
+    var buffer strings.Builder
+    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
+    if _, err := io.Copy(&buffer, limitedReader); err != nil {
+        return nil, wrapError(ErrDataTransfer, err, "error recibiendo listado")
+    }
+    dataConn.Close()
+
+    if err := s.finish(); err != nil {
+        return nil, err
+    }
+
+    var lines []string
+    for _, line := range strings.Split(buffer.String(), "\n") {
+        line = strings.TrimSpace(line)
+        if line != "" {
+            lines = append(lines, decodeText(s.settings.charset, line))
+        }
+    }
+    return lines, nil
+}
+
+// mkdir crea path e indica si ya existía como directorio.
+func (s *ftpSession) mkdir(path string) (bool, error) {
+    // Verificar si ya existe como archivo
+    if err := s.send("SIZE %s", path); err != nil {
+        return false, wrapError(ErrSizeCommand, err, "error enviando comando SIZE")
+    }
+    code, _, err := s.reply()
+    if err != nil {
+        return false, wrapError(ErrSizeResponse, err, "error leyendo respuesta SIZE")
+    }
+    if code == 213 {
+        return false, errorf(ErrFileConflict, "ya existe como archivo (conflicto)")
+    }
+
+    // Verificar si ya existe como directorio
+    if isDir, err := s.isDir(path); err != nil || isDir {
+        return isDir, err
+    }
+
+    // Crear el directorio
+    if err := s.send("MKD %s", path); err != nil {
+        return false, wrapError(ErrMkdirFailed, err, "error enviando comando MKD")
+    }
+    code, msg, err := s.reply()
+    if err != nil {
+        return false, wrapError(ErrMkdirResponse, err, "error leyendo respuesta MKD")
+    }
+    if code != 257 {
+        return false, replyError(ErrMkdirFailed, code, msg, "error creando directorio")
+    }
+    return false, nil
+}
+
+// mkdirAll crea dir y los directorios que le falten.
+func (s *ftpSession) mkdirAll(dir string) error {
+    if dir == "." || dir == "" {
+        return nil
+    }
+    current := ""
+    for _, part := range strings.Split(dir, "/") {
+        if part == "" {
+            continue
+        }
+        current += part
+        if _, err := s.mkdir(current); err != nil {
+            return err
+        }
+        current += "/"
+    }
+    return nil
+}
+
+// isDir indica si path es un directorio. Con MLST no cambia de directorio;
+// sin él entra con CWD y vuelve al anterior, y si PWD no lo dio falla en
+// lugar de adivinar cómo volver, para que la sesión se descarte.
+func (s *ftpSession) isDir(path string) (bool, error) {
+    if s.supports("MLST") {
+        info, err := s.mlst(path)
+        if err == nil {
+            return info.IsDir, nil
+        }
+        // 550 y similares: no existe. Si MLST no se admite o su respuesta
+        // no se entiende se recurre a CWD
+        if ReplyCode(err) != 0 && !mlsdUnsupported(err) {
+            return false, nil
+        }
+    }
+
+    cwd := s.pwd()
+    if err := s.send("CWD %s", path); err != nil {
+        return false, wrapError(ErrCwdCommand, err, "error enviando comando CWD")
+    }
+    code, _, err := s.reply()
+    if err != nil {
+        return false, wrapError(ErrCwdResponse, err, "error leyendo respuesta CWD")
+    }
+    if code != 250 {
+        return false, nil
+    }
+
+    // Volver al directorio anterior
+    if cwd == "" {
+        return true, errorf(ErrCwdResponse, "directorio actual desconocido: no se puede volver tras CWD")
+    }
+    code, msg, err := s.cmd(ErrCwdCommand, "CWD %s", cwd)
+    if err != nil {
+        return true, err
+    }
+    if code != 250 {
+        return true, replyError(ErrCwdResponse, code, msg, "error volviendo al directorio anterior")
+    }
+    return true, nil
+}
+
+// mlst devuelve los datos de path según MLST (RFC 3659).
+func (s *ftpSession) mlst(path string) (FileInfo, error) {
+    code, msg, err := s.cmd(ErrDataTransfer, "MLST %s", path)
+    if err != nil {
+        return FileInfo{}, err
+    }
+    if code != 250 {
+        return FileInfo{}, replyError(ErrDataTransfer, code, msg, "MLST no disponible")
+    }
+    for _, line := range strings.Split(msg, "\n") {
+        if info, _, ok := parseFacts(line); ok {
+            return info, nil
+        }
+    }
+    return FileInfo{}, errorf(ErrDataTransfer, "respuesta MLST inválida")
+}
+
+// mdtm devuelve la fecha de modificación de path según MDTM.
+func (s *ftpSession) mdtm(path string) (time.Time, error) {
+    code, msg, err := s.cmd(ErrDataTransfer, "MDTM %s", path)
+    if err != nil {
+        return time.Time{}, err
+    }
+    if code != 213 {
+        return time.Time{}, replyError(ErrDataTransfer, code, msg, "MDTM no disponible")
+    }
+    return parseFTPTime(strings.TrimSpace(msg))
+}
+
+// dele borra el archivo path; si es un directorio vacío usa RMD.
+func (s *ftpSession) dele(path string) error {
+    code, msg, err := s.cmd(ErrDeleteFailed, "DELE %s", path)
+    if err != nil {
+        return err
+    }
+    if code/100 == 2 {
+        return nil
+    }
+    if isDir, _ := s.isDir(path); !isDir {
+        return replyError(ErrDeleteFailed, code, msg, "error eliminando archivo")
+    }
+    code, msg, err = s.cmd(ErrDeleteFailed, "RMD %s", path)
+    if err != nil {
+        return err
+    }
+    if code/100 != 2 {
+        return replyError(ErrDeleteFailed, code, msg, "error eliminando directorio")
+    }
+    return nil
+}
+
+// rename mueve from a to con RNFR y RNTO.
+func (s *ftpSession) rename(from, to string) error {
+    code, msg, err := s.cmd(ErrRenameFailed, "RNFR %s", from)
+    if err != nil {
+        return err
+    }
+    if code != 350 {
+        return replyError(ErrRenameFailed, code, msg, "error renombrando")
+    }
+    code, msg, err = s.cmd(ErrRenameFailed, "RNTO %s", to)
+    if err != nil {
+        return err
+    }
+    if code/100 != 2 {
+        return replyError(ErrRenameFailed, code, msg, "error renombrando")
+    }
+    return nil
+}
+
+// noop comprueba que la sesión siga viva.
+func (s *ftpSession) noop() error {
+    code, msg, err := s.cmd(ErrConnectionFailed, "NOOP")
+    if err != nil {
+        return err
+    }
+    if code/100 != 2 {
+        return replyError(ErrConnectionFailed, code, msg, "NOOP rechazado")
+    }
+    return nil
+}
+
+// pwd devuelve el directorio de trabajo, o "" si el servidor no lo informa.
+func (s *ftpSession) pwd() string {
+    code, msg, err := s.cmd(ErrCwdCommand, "PWD")
+    if err != nil || code != 257 {
+        return ""
+    }
+    start := strings.Index(msg, "\"")
+    end := strings.LastIndex(msg, "\"")
+    if start == -1 || end <= start {
+        return ""
+    }
+    return strings.ReplaceAll(msg[start+1:end], "\"\"", "\"")
+}
+
+func (s *ftpSession) close() {
+    s.conn.SetDeadline(time.Now().Add(time.Second))
+    s.text.PrintfLine("QUIT")
+    s.text.Close()
+}
@@ -0,0 +1,142 @@
+package ftp
+
+import (
+    "bytes"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+// TestPasvControlHost comprueba que la conexión de datos usa el host de la
+// conexión de control aunque el servidor anuncie otra IP en PASV.
+func TestPasvControlHost(t *testing.T) {
+    for _, host := range []string{"0.0.0.0", "10.255.255.1"} {
+        t.Run(host, func(t *testing.T) {
+            mem := server.NewMemFS()
+            mem.WriteFile("/a.bin", []byte("contenido"))
+            srv := server.New(mem, map[string]string{"u": "p"})
+            // Sin rechazar EPSV el cliente nunca llegaría a enviar PASV
+            srv.Faults = []server.Fault{
+                {Command: "EPSV", Reply: "502 EPSV no disponible"},
+                {Command: "PASV", PasvHost: host},
+            }
+            if err := srv.Listen("127.0.0.1:0"); err != nil {
+                t.Fatal(err)
+            }
+            defer srv.Close()
+
+            done := make(chan struct{})
+            var data []byte
+            var err error
+            go func() {
+                defer close(done)
+                data, err = GetFTPBytes(srv.URL("u", "p", "/a.bin"))
+            }()
+            select {
+            case <-done:
+            case <-time.After(10 * time.Second):
+                t.Fatal("la descarga no terminó: se marcó la IP anunciada")
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.Equal(data, []byte("contenido")) {
+                t.Fatalf("contenido %q", data)
+            }
+        })
+    }
+}
+
+// TestEPSVFallback comprueba que si el servidor anuncia EPSV pero lo
+// rechaza se usa PASV, y que la sesión ya no vuelve a intentarlo.
+func TestEPSVFallback(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", []byte("contenido"))
+    srv := server.New(mem, map[string]string{"u": "p"})
+    // Un segundo EPSV en la misma sesión haría fallar la transferencia
+    srv.Faults = []server.Fault{
+        {Command: "EPSV", Times: 1, Reply: "502 EPSV no disponible tras NAT"},
+        {Command: "EPSV", Reply: "425 EPSV repetido"},
+    }
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    pool := NewPool(1, time.Minute)
+    defer pool.Close()
+    for i := 0; i < 2; i++ {
+        data, err := GetFTPBytes(srv.URL("u", "p", "/a.bin"), WithPool(pool))
+        if err != nil {
+            t.Fatalf("descarga %d: %v", i+1, err)
+        }
+        if !bytes.Equal(data, []byte("contenido")) {
+            t.Fatalf("descarga %d: contenido %q", i+1, data)
+        }
+    }
+
+    // Otros errores de EPSV no se ocultan
+    srv2 := server.New(mem, map[string]string{"u": "p"})
+    srv2.Faults = []server.Fault{{Command: "EPSV", Reply: "425 Sin puertos libres"}}
+    if err := srv2.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    defer srv2.Close()
+    if _, err := GetFTPBytes(srv2.URL("u", "p", "/a.bin")); ErrorCode(err) != ErrPasvMode || ReplyCode(err) != 425 {
+        t.Fatalf("EPSV 425: %v", err)
+    }
+}
+
+// TestIsDirWorkingDirectory comprueba que averiguar si una ruta es un
+// directorio no deja la sesión en otro directorio de trabajo.
+func TestIsDirWorkingDirectory(t *testing.T) {
+    start := func(faults ...server.Fault) (*server.Server, *server.MemFS) {
+        mem := server.NewMemFS()
+        mem.Mkdir("/a")
+        mem.Mkdir("/a/b")
+        srv := server.New(mem, map[string]string{"u": "p"})
+        srv.Faults = faults
+        if err := srv.Listen("127.0.0.1:0"); err != nil {
+            t.Fatal(err)
+        }
+        t.Cleanup(func() { srv.Close() })
+        return srv, mem
+    }
+
+    // Con MLST no hace falta CWD
+    srv, _ := start(server.Fault{Command: "CWD", Reply: "500 CWD desactivado"})
+    if existed, err := EnsureFTPDir(srv.URL("u", "p", "/a/b")); err != nil || !existed {
+        t.Fatalf("MLST: %v, %v", existed, err)
+    }
+
+    // Sin MLST ni PWD no se sabe volver: falla y la sesión se descarta, así
+    // que el siguiente MKD relativo se hace desde la raíz
+    srv, mem := start(
+        server.Fault{Command: "MLST", Reply: "502 No implementado"},
+        server.Fault{Command: "PWD", Reply: "502 No implementado"},
+    )
+    pool := NewPool(1, time.Minute)
+    defer pool.Close()
+    if _, err := EnsureFTPDir(srv.URL("u", "p", "/a/b"), WithPool(pool)); ErrorCode(err) != ErrCwdResponse {
+        t.Fatalf("sin PWD: %v", err)
+    }
+    if err := CreateFTPDir(srv.URL("u", "p", "/nuevo"), WithPool(pool)); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := mem.Stat("/nuevo"); err != nil {
+        t.Fatalf("MKD en otro directorio: %v", err)
+    }
+
+    // Con PWD vuelve exactamente al directorio anterior
+    srv, mem = start(server.Fault{Command: "MLST", Reply: "502 No implementado"})
+    if existed, err := EnsureFTPDir(srv.URL("u", "p", "/a/b"), WithPool(pool)); err != nil || !existed {
+        t.Fatalf("con PWD: %v, %v", existed, err)
+    }
+    if err := CreateFTPDir(srv.URL("u", "p", "/otro"), WithPool(pool)); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := mem.Stat("/otro"); err != nil {
+        t.Fatalf("MKD en otro directorio: %v", err)
+    }
+}
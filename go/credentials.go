@@ -0,0 +1,206 @@
+package ftp
+
+import (
+    "encoding/json"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+// Las URLs sin contraseña toman las credenciales, por este orden, de
+// SetFTPCredentials, del archivo de credenciales, de ~/.netrc y de las
+// variables FTP_USER y FTP_PASSWORD. Si la URL trae usuario solo se aceptan
+// credenciales de ese usuario; FTP_PASSWORD en concreto solo se usa si la
+// URL no trae usuario o si trae el mismo que FTP_USER.
+
+type credential struct {
+    User     string `json:"user"`
+    Password string `json:"password"`
+}
+
+var (
+    credMu      sync.RWMutex
+    credentials = map[string]credential{}
+)
+
+// SetFTPCredentials registra en memoria el usuario y la contraseña de host
+// ("servidor" o "servidor:puerto", este último tiene prioridad). Un password
+// vacío elimina el registro.
+func SetFTPCredentials(host, user, password string) error {
+    if host == "" {
+        return errorf(ErrMissingHostUser, "falta host")
+    }
+    credMu.Lock()
+    defer credMu.Unlock()
+    if password == "" {
+        delete(credentials, strings.ToLower(host))
+        return nil
+    }
+    credentials[strings.ToLower(host)] = credential{User: user, Password: password}
+    return nil
+}
+
+// fillCredentials completa u si no trae contraseña.
+func fillCredentials(u *url.URL) {
+    if _, ok := u.User.Password(); ok {
+        return
+    }
+    user := u.User.Username()
+    for _, lookup := range []func(*url.URL) []credential{memoryCredentials, fileCredentials, netrcCredentials, envCredentials} {
+        for _, c := range lookup(u) {
+            if user != "" && c.User != "" && c.User != user {
+                continue
+            }
+            if c.User != "" {
+                user = c.User
+            }
+            u.User = url.UserPassword(user, c.Password)
+            return
+        }
+    }
+}
+
+// hostKeys devuelve las claves con las que se busca u: con puerto y sin él.
+func hostKeys(u *url.URL) []string {
+    host := strings.ToLower(u.Hostname())
+    if u.Port() != "" {
+        return []string{strings.ToLower(u.Host), host}
+    }
+    return []string{host}
+}
+
+func memoryCredentials(u *url.URL) []credential {
+    credMu.RLock()
+    defer credMu.RUnlock()
+    var found []credential
+    for _, key := range hostKeys(u) {
+        if c, ok := credentials[key]; ok {
+            found = append(found, c)
+        }
+    }
+    return found
+}
+
+// fileCredentials lee el archivo de FTP_CREDENTIALS o
+// <config>/ftp/credentials.json, un objeto JSON indexado por host:
+//
+//	{"ftp.ejemplo.com": {"user": "ana", "password": "secreto"}}
+func fileCredentials(u *url.URL) []credential {
+    path := os.Getenv("FTP_CREDENTIALS")
+    if path == "" {
+        dir, err := os.UserConfigDir()
+        if err != nil {
+            return nil
+        }
+        path = filepath.Join(dir, "ftp", "credentials.json")
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil
+    }
+    var hosts map[string]credential
+    if err := json.Unmarshal(data, &hosts); err != nil {
+        return nil
+    }
+    lower := make(map[string]credential, len(hosts))
+    for host, c := range hosts {
+        lower[strings.ToLower(host)] = c
+    }
+
+    var found []credential
+    for _, key := range hostKeys(u) {
+        if c, ok := lower[key]; ok {
+            found = append(found, c)
+        }
+    }
+    return found
+}
+
+// netrcCredentials lee $NETRC o ~/.netrc; las entradas "machine" del host
+// van antes que "default".
+func netrcCredentials(u *url.URL) []credential {
+    path := os.Getenv("NETRC")
+    if path == "" {
+        home, err := os.UserHomeDir()
+        if err != nil {
+            return nil
+        }
+        path = filepath.Join(home, ".netrc")
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil
+    }
+
+    var found, fallback []credential
+    host := strings.ToLower(u.Hostname())
+    for _, e := range parseNetrc(string(data)) {
+        switch {
+        case e.machine == "":
+            fallback = append(fallback, e.credential)
+        case strings.ToLower(e.machine) == host:
+            found = append(found, e.credential)
+        }
+    }
+    return append(found, fallback...)
+}
+
+// envCredentials toma FTP_USER y FTP_PASSWORD. Sin FTP_USER no se sabe de
+// quién es la contraseña, así que una URL con usuario solo la recibe si
+// coincide con FTP_USER.
+func envCredentials(u *url.URL) []credential {
+    pass, ok := os.LookupEnv("FTP_PASSWORD")
+    if !ok {
+        return nil
+    }
+    user := os.Getenv("FTP_USER")
+    if name := u.User.Username(); name != "" && name != user {
+        return nil
+    }
+    return []credential{{User: user, Password: pass}}
+}
+
+// netrcEntry es una máquina del archivo netrc; machine vacío es "default".
+type netrcEntry struct {
+    machine string
+    credential
+}
+
+func parseNetrc(data string) []netrcEntry {
+    var entries []netrcEntry
+    var current *netrcEntry
+    tokens := strings.Fields(data)
+    for i := 0; i < len(tokens); i++ {
+        next := func() string {
+            if i+1 < len(tokens) {
+                i++
+                return tokens[i]
+            }
+            return ""
+        }
+        switch tokens[i] {
+        case "machine":
+            entries = append(entries, netrcEntry{machine: next()})
+            current = &entries[len(entries)-1]
+        case "default":
+            entries = append(entries, netrcEntry{})
+            current = &entries[len(entries)-1]
+        case "login":
+            if current != nil {
+                current.User = next()
+            }
+        case "password":
+            if current != nil {
+                current.Password = next()
+            }
+        case "account":
+            next()
+        case "macdef":
+            // Las macros no se usan
+            current = nil
+        }
+    }
+    return entries
+}
@@ -0,0 +1,135 @@
+package ftp
+
+import (
+    "crypto/md5"
+    "crypto/sha256"
+    "encoding/hex"
+    "hash"
+    "hash/crc32"
+    "io"
+)
+
+// Digests son los hashes, en hexadecimal, de los bytes transferidos.
+type Digests struct {
+    MD5    string `json:"md5"`
+    SHA256 string `json:"sha256"`
+    CRC32  string `json:"crc32"`
+}
+
+// WithDigests calcula MD5, SHA-256 y CRC32 de los bytes mientras se
+// descargan o suben y los deja en d si la transferencia termina bien, sin
+// volver a leer los datos. Los bytes que se repiten al reanudar tras un
+// reintento se cuentan una sola vez.
+func WithDigests(d *Digests) Option {
+    return func(cfg *config) {
+        cfg.digests = d
+    }
+}
+
+// digester acumula los hashes de los bytes según su posición en el archivo.
+type digester struct {
+    out   *Digests
+    md5   hash.Hash
+    sha   hash.Hash
+    crc   hash.Hash
+    w     io.Writer
+    added int64 // bytes ya incluidos
+}
+
+func newDigester(out *Digests) *digester {
+    d := &digester{out: out}
+    d.reset()
+    return d
+}
+
+func (d *digester) reset() {
+    d.md5, d.sha, d.crc = md5.New(), sha256.New(), crc32.NewIEEE()
+    d.w = io.MultiWriter(d.md5, d.sha, d.crc)
+    d.added = 0
+}
+
+// add incluye b, que empieza en la posición pos, saltándose lo ya incluido.
+func (d *digester) add(pos int64, b []byte) {
+    end := pos + int64(len(b))
+    if pos > d.added || end <= d.added {
+        return
+    }
+    d.w.Write(b[d.added-pos:])
+    d.added = end
+}
+
+// finish deja los hashes en el destino de WithDigests.
+func (d *digester) finish() {
+    if d == nil {
+        return
+    }
+    *d.out = Digests{
+        MD5:    hex.EncodeToString(d.md5.Sum(nil)),
+        SHA256: hex.EncodeToString(d.sha.Sum(nil)),
+        CRC32:  hex.EncodeToString(d.crc.Sum(nil)),
+    }
+}
+
+// digestSink calcula los hashes de una descarga.
+type digestSink struct {
+    sink
+    d *digester
+}
+
+func (s digestSink) Write(b []byte) (int, error) {
+    pos := s.sink.offset()
+    n, err := s.sink.Write(b)
+    s.d.add(pos, b[:n])
+    return n, err
+}
+
+func (s digestSink) reset() error {
+    s.d.reset()
+    return s.sink.reset()
+}
+
+// digestSink envuelve dst si hay WithDigests.
+func (cfg *config) digestSink(dst sink) (sink, *digester) {
+    if cfg.digests == nil {
+        return dst, nil
+    }
+    d := newDigester(cfg.digests)
+    return digestSink{sink: dst, d: d}, d
+}
+
+// digestReader calcula los hashes de una subida.
+type digestReader struct {
+    io.ReadSeeker
+    d     *digester
+    total int64
+    pos   int64
+}
+
+func (r *digestReader) Read(b []byte) (int, error) {
+    n, err := r.ReadSeeker.Read(b)
+    r.d.add(r.pos, b[:n])
+    r.pos += int64(n)
+    return n, err
+}
+
+func (r *digestReader) Seek(offset int64, whence int) (int64, error) {
+    pos, err := r.ReadSeeker.Seek(offset, whence)
+    if err == nil {
+        r.pos = pos
+    }
+    return pos, err
+}
+
+// Size da lo que queda por leer, como progressReader.
+func (r *digestReader) Size() int64 {
+    return r.total - r.pos
+}
+
+// digestReader envuelve src, de tamaño total, si hay WithDigests.
+func (cfg *config) digestReader(src io.ReadSeeker, total int64) (io.ReadSeeker, *digester) {
+    if cfg.digests == nil {
+        return src, nil
+    }
+    d := newDigester(cfg.digests)
+    return &digestReader{ReadSeeker: src, d: d, total: total}, d
+}
@@ -0,0 +1,87 @@
+package ftp
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "strings"
+
+    "github.com/pkg/sftp"
+)
+
+// Error es el error devuelto por las operaciones del paquete. Su texto
+// conserva el formato "error code N: ..." de los mensajes originales.
+type Error struct {
+    Code  int    // código Err* (negativo)
+    Reply int    // respuesta FTP del servidor, 0 si el fallo fue local o de red
+    Msg   string
+    Err   error
+}
+
+func (e *Error) Error() string {
+    msg := fmt.Sprintf("error code %d: %s", e.Code, e.Msg)
+    if e.Reply != 0 {
+        msg += fmt.Sprintf(" (respuesta %d)", e.Reply)
+    }
+    if e.Err != nil {
+        msg += ": " + e.Err.Error()
+    }
+    return msg
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+    return &Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+func wrapError(code int, err error, msg string) error {
+    return &Error{Code: code, Msg: msg, Err: err}
+}
+
+func replyError(code, reply int, text, msg string) error {
+    e := &Error{Code: code, Reply: reply, Msg: msg}
+    if text = strings.TrimSpace(text); text != "" {
+        e.Err = errors.New(text)
+    }
+    return e
+}
+
+// sftpError clasifica un fallo de SFTP: la pérdida de la conexión SSH se
+// reporta como ErrSftpConnection para que pueda reintentarse.
+func sftpError(err error, msg string) error {
+    var netErr net.Error
+    if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.EOF) ||
+        errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+        return wrapError(ErrSftpConnection, err, msg)
+    }
+    return wrapError(ErrSftpOperation, err, msg)
+}
+
+// ErrorCode devuelve el código Err* asociado a err, o 0 si no tiene.
+func ErrorCode(err error) int {
+    if err == nil {
+        return 0
+    }
+    var e *Error
+    if errors.As(err, &e) {
+        return e.Code
+    }
+    var code int
+    if _, scanErr := fmt.Sscanf(err.Error(), "error code %d:", &code); scanErr == nil {
+        return code
+    }
+    return 0
+}
+
+// ReplyCode devuelve la respuesta FTP que provocó err, o 0 si no hubo.
+func ReplyCode(err error) int {
+    var e *Error
+    if errors.As(err, &e) {
+        return e.Reply
+    }
+    return 0
+}
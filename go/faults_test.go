@@ -0,0 +1,206 @@
+package ftp
+
+import (
+    "bytes"
+    "context"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "math/rand"
+    "path"
+    "slices"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+// scenarioOp es una operación que se repite contra cada escenario de
+// server.Scenarios, con un servidor nuevo porque los fallos se cuentan por
+// servidor. run comprueba el resultado cuando no hay error.
+type scenarioOp struct {
+    name string
+    run  func(srv *server.Server, mem *server.MemFS, opts ...Option) error
+}
+
+// scenarioNames es el contenido de la raíz de scenarioServer.
+var scenarioNames = []string{"buzon", "datos.bin", "log.bin"}
+
+// scenarioData supera el DataLimit de 421-mid-transfer.
+var scenarioData = func() []byte {
+    data := make([]byte, 8<<10)
+    rand.New(rand.NewSource(1)).Read(data)
+    return data
+}()
+
+// stored comprueba que mem guarde data en name.
+func stored(mem *server.MemFS, name string, data []byte) error {
+    if got, _ := mem.ReadFile(name); !bytes.Equal(got, data) {
+        return fmt.Errorf("%s: %d bytes distintos de los %d esperados", name, len(got), len(data))
+    }
+    return nil
+}
+
+// errNoResult marca que GetFTPFile o ListFTPFiles devolvieron vacío, que es
+// como informan de un error.
+var errNoResult = errors.New("resultado vacío")
+
+var scenarioOps = []scenarioOp{
+    {"GetFTPBytes", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        data, err := GetFTPBytes(srv.URL("u", "p", "/datos.bin"), opts...)
+        if err == nil && !bytes.Equal(data, scenarioData) {
+            err = fmt.Errorf("descargados %d bytes distintos de los %d esperados", len(data), len(scenarioData))
+        }
+        return err
+    }},
+    {"GetFTPFile", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        got := GetFTPFile(srv.URL("u", "p", "/datos.bin"), opts...)
+        switch {
+        case got == "":
+            return errNoResult
+        case got != base64.StdEncoding.EncodeToString(scenarioData):
+            return fmt.Errorf("descarga distinta en base64")
+        }
+        return nil
+    }},
+    {"PutFTPFile", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        if err := PutFTPFile(base64.StdEncoding.EncodeToString(scenarioData), srv.URL("u", "p", "/subida.bin"), opts...); err != nil {
+            return err
+        }
+        return stored(mem, "/subida.bin", scenarioData)
+    }},
+    {"ListFTPDir", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        names, err := ListFTPDir(srv.URL("u", "p", "/"), opts...)
+        if err == nil && !slices.Equal(names, scenarioNames) {
+            err = fmt.Errorf("listado %q", names)
+        }
+        return err
+    }},
+    {"ListFTPFiles", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        names := ListFTPFiles(srv.URL("u", "p", "/"), opts...)
+        switch {
+        case names == nil:
+            return errNoResult
+        case !slices.Equal(names, scenarioNames):
+            return fmt.Errorf("listado %q", names)
+        }
+        return nil
+    }},
+    {"StatFTPFile", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        info, err := StatFTPFile(srv.URL("u", "p", "/datos.bin"), opts...)
+        if err == nil && (info.Size != int64(len(scenarioData)) || info.IsDir) {
+            err = fmt.Errorf("información %+v", info)
+        }
+        return err
+    }},
+    {"CreateFTPDir", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        if err := CreateFTPDir(srv.URL("u", "p", "/nuevo"), opts...); err != nil {
+            return err
+        }
+        if info, err := mem.Stat("/nuevo"); err != nil || !info.IsDir() {
+            return fmt.Errorf("directorio no creado: %v", err)
+        }
+        return nil
+    }},
+    {"AppendFTPFile", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        if err := AppendFTPFile(base64.StdEncoding.EncodeToString(scenarioData), srv.URL("u", "p", "/log.bin"), opts...); err != nil {
+            return err
+        }
+        return stored(mem, "/log.bin", append([]byte("inicio\n"), scenarioData...))
+    }},
+    {"PutFTPFileUnique", func(srv *server.Server, mem *server.MemFS, opts ...Option) error {
+        name, err := PutFTPFileUnique(base64.StdEncoding.EncodeToString(scenarioData), srv.URL("u", "p", "/buzon")+"/", opts...)
+        if err != nil {
+            return err
+        }
+        if path.Dir(name) != "/buzon" {
+            return fmt.Errorf("nombre asignado %q", name)
+        }
+        return stored(mem, name, scenarioData)
+    }},
+}
+
+// scenarioServer arranca un servidor con los archivos que esperan las
+// operaciones y los fallos del escenario.
+func scenarioServer(t *testing.T, faults []server.Fault) (*server.Server, *server.MemFS) {
+    t.Helper()
+    mem := server.NewMemFS()
+    mem.WriteFile("/datos.bin", scenarioData)
+    mem.WriteFile("/log.bin", []byte("inicio\n"))
+    mem.Mkdir("/buzon")
+    srv := server.New(mem, map[string]string{"u": "p"})
+    srv.Faults = faults
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { srv.Close() })
+    return srv, mem
+}
+
+// scenarioFailures son los fallos que cada escenario provoca sin reintentos,
+// con el código Err* y la respuesta del servidor esperados; el resto de
+// operaciones debe funcionar igualmente.
+var scenarioFailures = map[string]map[string][2]int{
+    "421-mid-transfer": {
+        "GetFTPBytes": {ErrTransferConfirm, 421},
+        "GetFTPFile":  {ErrTransferConfirm, 421},
+        "PutFTPFile":  {ErrTransferConfirm, 421},
+    },
+    "busy-first-login": {
+        "GetFTPBytes":      {ErrConnectionFailed, 421},
+        "GetFTPFile":       {ErrConnectionFailed, 421},
+        "PutFTPFile":       {ErrConnectionFailed, 421},
+        "ListFTPDir":       {ErrConnectionFailed, 421},
+        "ListFTPFiles":     {ErrConnectionFailed, 421},
+        "StatFTPFile":      {ErrConnectionFailed, 421},
+        "CreateFTPDir":     {ErrConnectionFailed, 421},
+        "AppendFTPFile":    {ErrConnectionFailed, 421},
+        "PutFTPFileUnique": {ErrConnectionFailed, 421},
+    },
+    "transient-425": {
+        "GetFTPBytes": {ErrDataTransfer, 425},
+        "GetFTPFile":  {ErrDataTransfer, 425},
+        "PutFTPFile":  {ErrDataTransfer, 425},
+    },
+}
+
+// TestScenarios ejecuta cada operación contra cada escenario: con la
+// política de reintentos por defecto todas deben terminar bien, y sin ella
+// las que alcanza un fallo transitorio devuelven su *Error.
+func TestScenarios(t *testing.T) {
+    policy := DefaultRetryPolicy()
+    policy.InitialBackoff = time.Millisecond
+    policy.Jitter = 0
+
+    for _, scenario := range server.Scenarios() {
+        for _, op := range scenarioOps {
+            t.Run(scenario.Name+"/"+op.name, func(t *testing.T) {
+                // Cada caso tiene sus propios servidores
+                t.Parallel()
+                // Un cliente que marque la IP de PASV se quedaría esperando
+                ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+                defer cancel()
+                srv, mem := scenarioServer(t, scenario.Faults)
+                if err := op.run(srv, mem, WithRetry(policy), WithContext(ctx)); err != nil {
+                    t.Errorf("con reintentos: %v", err)
+                }
+
+                srv, mem = scenarioServer(t, scenario.Faults)
+                err := op.run(srv, mem, WithRetry(RetryPolicy{MaxAttempts: 1}), WithContext(ctx))
+                want, fails := scenarioFailures[scenario.Name][op.name]
+                switch {
+                case !fails && err != nil:
+                    t.Errorf("sin reintentos: %v", err)
+                case fails && err == errNoResult:
+                    // Las variantes sin error solo pueden devolver vacío
+                case fails && (ErrorCode(err) != want[0] || ReplyCode(err) != want[1]):
+                    t.Errorf("sin reintentos: %v, se esperaba el código %d con respuesta %d", err, want[0], want[1])
+                }
+                var e *Error
+                if fails && err != errNoResult && !errors.As(err, &e) {
+                    t.Errorf("sin reintentos: %T no es *Error", err)
+                }
+            })
+        }
+    }
+}
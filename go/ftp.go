@@ -2,11 +2,16 @@ package ftp
 
 import (
     "bytes"
+    "context"
+    "crypto/rand"
     "encoding/base64"
+    "encoding/hex"
     "fmt"
     "io"
     "net"
     "net/url"
+    "os"
+    "path"
     "path/filepath"
     "strconv"
     "strings"
@@ -24,33 +29,41 @@ const (
 
 // Error codes
 const (
-    ErrEmptyData        = -1
-    ErrEmptyURL         = -2
-    ErrInvalidScheme    = -3
-    ErrMissingHostUser  = -4
-    ErrMissingPath      = -5
-    ErrConnectionFailed = -6
-    ErrInitialRead      = -7
-    ErrUserSend         = -8
-    ErrUserAuth         = -9
-    ErrPassSend         = -10
-    ErrPassAuth         = -11
-    ErrMkdirFailed      = -12
-    ErrMkdirResponse    = -13
-    ErrPasvMode         = -14
-    ErrSizeCommand      = -15
-    ErrSizeResponse     = -16
-    ErrFileConflict     = -17
-    ErrCwdCommand       = -18
-    ErrCwdResponse      = -19
-    ErrTypeCommand      = -20
-    ErrStorCommand      = -21
-    ErrDataTransfer     = -22
-    ErrTransferConfirm  = -23
-    ErrAsciiMode        = -24
-    ErrSftpConnection   = -25
-    ErrSftpClient       = -26
-    ErrSftpOperation    = -27
+    ErrEmptyData           = -1
+    ErrEmptyURL            = -2
+    ErrInvalidScheme       = -3
+    ErrMissingHostUser     = -4
+    ErrMissingPath         = -5
+    ErrConnectionFailed    = -6
+    ErrInitialRead         = -7
+    ErrUserSend            = -8
+    ErrUserAuth            = -9
+    ErrPassSend            = -10
+    ErrPassAuth            = -11
+    ErrMkdirFailed         = -12
+    ErrMkdirResponse       = -13
+    ErrPasvMode            = -14
+    ErrSizeCommand         = -15
+    ErrSizeResponse        = -16
+    ErrFileConflict        = -17
+    ErrCwdCommand          = -18
+    ErrCwdResponse         = -19
+    ErrTypeCommand         = -20
+    ErrStorCommand         = -21
+    ErrDataTransfer        = -22
+    ErrTransferConfirm     = -23
+    ErrAsciiMode           = -24
+    ErrSftpConnection      = -25
+    ErrSftpClient          = -26
+    ErrSftpOperation       = -27
+    ErrInvalidOption       = -28
+    ErrCanceled            = -29
+    ErrDeleteFailed        = -30
+    ErrRenameFailed        = -31
+    ErrInvalidPath         = -32
+    ErrChecksumMismatch    = -33
+    ErrChecksumUnsupported = -34
+    ErrWriteRefused        = -35
 )
 
 func parsePASV(resp string) (string, error) {
@@ -81,34 +94,53 @@ func isSFTP(urlStr string) bool {
     return u.Scheme == "sftp"
 }
 
-func createSFTPClient(ftpUrl string) (*sftp.Client, *ssh.Client, error) {
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return nil, nil, fmt.Errorf("error parsing URL: %v", err)
-    }
-
+func createSFTPClient(ctx context.Context, u *url.URL, tuning SFTPTuning) (*sftp.Client, *ssh.Client, error) {
     user := u.User.Username()
-    pass, _ := u.User.Password()
+    pass, hasPass := u.User.Password()
     host := u.Host
     if !strings.Contains(host, ":") {
         host += ":22"
     }
+    settings := settingsFor(u)
+
+    var auth []ssh.AuthMethod
+    if settings.keyFile != "" {
+        signer, err := loadPrivateKey(settings.keyFile, settings.passphrase)
+        if err != nil {
+            return nil, nil, fmt.Errorf("error code %d: failed to load private key: %v", ErrSftpConnection, err)
+        }
+        auth = append(auth, ssh.PublicKeys(signer))
+    }
+    if hasPass || settings.keyFile == "" {
+        auth = append(auth, ssh.Password(pass))
+    }
 
     config := &ssh.ClientConfig{
-        User: user,
-        Auth: []ssh.AuthMethod{
-            ssh.Password(pass),
-        },
-        HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-        Timeout:         timeout,
+        User:            user,
+        Auth:            auth,
+        HostKeyCallback: hostKeyCallback(settings.hostKey),
+        Timeout:         settings.timeout,
     }
 
-    conn, err := ssh.Dial("tcp", host, config)
+    dialer := net.Dialer{Timeout: settings.timeout}
+    netConn, err := dialer.DialContext(ctx, "tcp", host)
     if err != nil {
         return nil, nil, fmt.Errorf("error code %d: failed to connect to SFTP server: %v", ErrSftpConnection, err)
     }
 
-    client, err := sftp.NewClient(conn)
+    // El handshake SSH no tiene timeout propio
+    netConn.SetDeadline(time.Now().Add(settings.timeout))
+    stop := context.AfterFunc(ctx, func() { netConn.Close() })
+    sshConn, chans, reqs, err := ssh.NewClientConn(netConn, host, config)
+    stop()
+    if err != nil {
+        netConn.Close()
+        return nil, nil, fmt.Errorf("error code %d: failed to connect to SFTP server: %v", ErrSftpConnection, err)
+    }
+    netConn.SetDeadline(time.Time{})
+    conn := ssh.NewClient(sshConn, chans, reqs)
+
+    client, err := sftp.NewClient(conn, tuning.clientOptions()...)
     if err != nil {
         conn.Close()
         return nil, nil, fmt.Errorf("error code %d: failed to create SFTP client: %v", ErrSftpClient, err)
@@ -118,227 +150,306 @@ func createSFTPClient(ftpUrl string) (*sftp.Client, *ssh.Client, error) {
 }
 
 
-func GetFTPFile(ftpUrl string) string {
-    if ftpUrl == "" {
-        return ""
-    }
-
-    if isSFTP(ftpUrl) {
-        return GetSFTPFile(ftpUrl)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(ftpUrl)
-    if err != nil || u.Scheme != "ftp" {
-        return ""
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return ""
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return ""
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+// loadPrivateKey lee una clave privada SSH, cifrada si passphrase no está
+// vacía.
+func loadPrivateKey(path, passphrase string) (ssh.Signer, error) {
+    data, err := os.ReadFile(path)
     if err != nil {
-        return ""
-    }
-
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return ""
+        return nil, err
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return ""
+    if passphrase != "" {
+        return ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
     }
+    return ssh.ParsePrivateKey(data)
+}
 
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return ""
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return ""
+// hostKeyCallback acepta solo la clave con la huella fingerprint, o
+// cualquiera si está vacía.
+func hostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+    if fingerprint == "" {
+        return ssh.InsecureIgnoreHostKey()
     }
-
-    if _, err := fmt.Fprintf(conn, "TYPE I\r\n"); err != nil {
-        return ""
+    return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+        if got := ssh.FingerprintSHA256(key); got != fingerprint {
+            return fmt.Errorf("host key %s does not match %s", got, fingerprint)
+        }
+        return nil
     }
-    conn.Read(buf[:])
+}
 
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return ""
-    }
-    n, err = conn.Read(buf[:])
+// parseURL valida la URL, su esquema y sus parámetros, aplica su perfil y
+// completa las credenciales que falten.
+func parseURL(rawUrl, scheme string) (*url.URL, error) {
+    u, err := url.Parse(rawUrl)
     if err != nil {
-        return ""
+        return nil, errorf(ErrEmptyURL, "error analizando URL: %v", err)
     }
-
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return ""
+    if u.Scheme != scheme {
+        return nil, errorf(ErrInvalidScheme, "URL no es %s", strings.ToUpper(scheme))
     }
-
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return ""
+    if strings.ContainsAny(u.Path, "\r\n\x00") {
+        return nil, errorf(ErrInvalidPath, "ruta con caracteres de control")
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
-
-    if _, err := fmt.Fprintf(conn, "RETR %s\r\n", path); err != nil {
-        return ""
+    if u.Fragment != "" {
+        // Un "#" sin codificar corta la ruta en silencio
+        return nil, errorf(ErrInvalidPath, "la ruta contiene #, codifíquelo como %%23")
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return ""
+    if strings.Contains(strings.ToLower(u.EscapedPath()), "%2f") {
+        // Decodificada sería otra ruta: "a%2Fb" pasaría a ser el directorio a
+        return nil, errorf(ErrInvalidPath, "la ruta contiene una / codificada (%%2F)")
     }
-
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return ""
+    if err := checkParams(u); err != nil {
+        return nil, err
     }
-
-    if limitedReader.N <= 0 {
-        return ""
+    if err := applyProfile(u); err != nil {
+        return nil, err
     }
-
-    if buffer.Len() == 0 {
-        return ""
+    if scheme == "ftp" {
+        if _, err := encodeText(settingsFor(u).charset, u.Path); err != nil {
+            return nil, wrapError(ErrInvalidPath, err, "nombre no representable")
+        }
     }
-
-    encoded := base64.StdEncoding.EncodeToString(buffer.Bytes())
-    return encoded
+    fillCredentials(u)
+    return u, nil
 }
 
-func GetFTPText(ftpUrl string) string {
-    if ftpUrl == "" {
-        return ""
-    }
-
-    if isSFTP(ftpUrl) {
-        return GetSFTPText(ftpUrl)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(ftpUrl)
-    if err != nil || u.Scheme != "ftp" {
-        return ""
+// getFTP descarga el archivo en dst en el tipo indicado ("I" binario, "A"
+// texto). Si un intento se corta, el siguiente continúa con REST desde lo
+// recibido.
+func getFTP(ftpUrl, mode string, dst sink, limit int64, cfg *config) error {
+    u, err := parseURL(ftpUrl, "ftp")
+    if err != nil {
+        return err
     }
+    dst, digest := cfg.digestSink(dst)
+    dst, setTotal := cfg.trackSink(dst)
+    mode = transferType(u, mode)
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    if !strings.Contains(host, ":") {
-        host += ":21"
+        if err := s.setType(mode); err != nil {
+            return err
+        }
+        if err := s.setMode(useModeZ(u, cfg)); err != nil {
+            return err
+        }
+        if cfg.progress != nil && mode == "I" && s.supports("SIZE") {
+            if size, err := s.size(u.Path); err == nil {
+                setTotal(size)
+            }
+        }
+        offset := dst.offset()
+        if offset > 0 && (mode != "I" || !s.canResume() || s.rest(offset) != nil) {
+            if err := dst.reset(); err != nil {
+                return wrapError(ErrDataTransfer, err, "no se puede reiniciar la descarga")
+            }
+            offset = 0
+        }
+        return s.retr(u.Path, dst, offset, limit)
+    })
+    if err != nil {
+        return err
     }
-
-    if host == "" || user == "" {
-        return ""
+    digest.finish()
+    if mode != "I" {
+        return nil
     }
+    return verify(u, cfg, dst.copyTo)
+}
 
-    conn, err := net.DialTimeout("tcp", host, timeout)
+// putFTP sube src en el tipo indicado. Si un intento binario se corta tras
+// enviar datos, el siguiente consulta SIZE y continúa desde ahí. Al anexar
+// (APPE) lo enviado se deduce del tamaño que tenía el archivo al empezar.
+// Con STOU, una vez asignado el nombre los reintentos continúan sobre él.
+func putFTP(ftpUrl string, src io.ReadSeeker, mode string, cfg *config) error {
+    u, err := parseURL(ftpUrl, "ftp")
     if err != nil {
-        return ""
+        return err
     }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+    total, err := sourceSize(src)
     if err != nil {
-        return ""
-    }
+        return wrapError(ErrDataTransfer, err, "error leyendo datos")
+    }
+    raw := src
+    src, digest := cfg.digestReader(src, total)
+    src = cfg.trackReader(src, total)
+    mode = transferType(u, mode)
+    mkdirs := makeDirs(u, false)
+
+    started, checked := false, cfg.appending || cfg.unique != nil
+    assigned := false // STOU ya eligió el nombre
+    base := int64(-1) // tamaño remoto antes de anexar, -1 si se desconoce
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return ""
+        if err := s.setType(mode); err != nil {
+            return err
+        }
+        if err := s.setMode(useModeZ(u, cfg)); err != nil {
+            return err
+        }
+        if mkdirs {
+            if err := s.mkdirAll(filepath.Dir(strings.TrimPrefix(u.Path, "/"))); err != nil {
+                return err
+            }
+        }
+        // Tras un intento fallido el destino puede ser ya el nuestro
+        if !checked {
+            if err := s.checkOverwrite(overwriteMode(u, cfg), u.Path, total, cfg.modTime); err != nil {
+                return err
+            }
+            checked = true
+        }
+        if cfg.unique != nil && !assigned {
+            if _, err := src.Seek(0, io.SeekStart); err != nil {
+                return wrapError(ErrDataTransfer, err, "error leyendo datos")
+            }
+            name, n, err := s.stou(u.Path, src)
+            if name != "" {
+                u.Path, *cfg.unique, assigned = name, name, true
+            }
+            if n > 0 {
+                started = true
+            }
+            return err
+        }
+        verb := "STOR"
+        offset := int64(0)
+        switch {
+        case cfg.appending && !started:
+            verb = "APPE"
+            base = -1
+            if size, err := s.size(u.Path); err == nil {
+                base = size
+            } else if ReplyCode(err) == 550 {
+                base = 0
+            }
+        case cfg.appending:
+            // Sin saber cuánto se añadió, repetir duplicaría datos
+            verb = "APPE"
+            size, err := s.size(u.Path)
+            if mode != "I" || base < 0 || err != nil || size < base || (total >= 0 && size-base > total) {
+                return errorf(ErrDataTransfer, "no se puede reanudar el anexado")
+            }
+            offset = size - base
+        case started && mode == "I" && s.canResume():
+            if size, err := s.size(u.Path); err == nil && (total < 0 || size <= total) && s.rest(size) == nil {
+                offset = size
+            }
+        }
+        if _, err := src.Seek(offset, io.SeekStart); err != nil {
+            return wrapError(ErrDataTransfer, err, "error leyendo datos")
+        }
+        n, err := s.upload(verb, u.Path, src)
+        if n > 0 {
+            started = true
+        }
+        return err
+    })
+    if err != nil {
+        return err
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return ""
+    digest.finish()
+    // Al anexar el hash remoto incluye el contenido anterior
+    if mode != "I" || cfg.appending {
+        return nil
     }
+    return verify(u, cfg, copySource(raw))
+}
 
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return ""
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return ""
+// listFTP devuelve los nombres del directorio. Con MLSD cada nombre llega
+// entero y separado de sus datos; sin él se interpreta la salida de LIST,
+// cuyo formato depende del servidor.
+func listFTP(ftpUrl string, cfg *config) ([]string, error) {
+    u, err := parseURL(ftpUrl, "ftp")
+    if err != nil {
+        return nil, err
     }
 
-    if _, err := fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return ""
-    }
-    conn.Read(buf[:])
+    var names []string
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return ""
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return ""
-    }
+        if err := s.setType("A"); err != nil {
+            return err
+        }
+        names = nil
+        if s.supports("MLST") {
+            entries, err := s.listMLSD(u.Path)
+            if err == nil {
+                for _, info := range entries {
+                    names = append(names, info.Name)
+                }
+                return nil
+            }
+            if !mlsdUnsupported(err) {
+                return err
+            }
+        }
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return ""
-    }
+        lines, err := s.list("LIST", u.Path)
+        if err != nil {
+            return err
+        }
+        for _, line := range lines {
+            if info, ok := parseListLine(line); ok {
+                names = append(names, info.Name)
+                continue
+            }
+            parts := strings.Fields(line)
+            if len(parts) > 0 {
+                names = append(names, parts[len(parts)-1])
+            }
+        }
+        return nil
+    })
+    return names, err
+}
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
+func GetFTPFile(ftpUrl string, opts ...Option) string {
+    if ftpUrl == "" {
         return ""
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
 
-    if _, err := fmt.Fprintf(conn, "RETR %s\r\n", path); err != nil {
-        return ""
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return ""
+    if isSFTP(ftpUrl) {
+        return GetSFTPFile(ftpUrl, opts...)
     }
 
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
+    var buffer bufferSink
+    if err := getFTP(ftpUrl, "I", &buffer, maxFileSize, newConfig(opts)); err != nil || buffer.Len() == 0 {
         return ""
     }
+    return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
 
-    if limitedReader.N <= 0 {
+func GetFTPText(ftpUrl string, opts ...Option) string {
+    if ftpUrl == "" {
         return ""
     }
 
-    if buffer.Len() == 0 {
-        return ""
+    if isSFTP(ftpUrl) {
+        return GetSFTPText(ftpUrl, opts...)
     }
 
-    text := buffer.String()
-    text = strings.ReplaceAll(text, "\r\n", "\n")
-    text = strings.TrimSpace(text)
+    text, _ := ReadFTPText(ftpUrl, opts...)
     return text
 }
 
-func PutFTPFile(base64Data, ftpUrl string) error {
+func PutFTPFile(base64Data, ftpUrl string, opts ...Option) error {
     if base64Data == "" {
         return fmt.Errorf("error code %d: datos vacíos", ErrEmptyData)
     }
@@ -352,524 +463,484 @@ func PutFTPFile(base64Data, ftpUrl string) error {
     }
 
     if isSFTP(ftpUrl) {
-        return PutSFTPFile(base64Data, ftpUrl)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return fmt.Errorf("error analizando URL: %v", err)
-    }
-    if u.Scheme != "ftp" {
-        return fmt.Errorf("error code %d: URL no es FTP", ErrInvalidScheme)
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return fmt.Errorf("error code %d: falta host o usuario", ErrMissingHostUser)
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return fmt.Errorf("error code %d: conexión fallida: %v", ErrConnectionFailed, err)
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
-        return fmt.Errorf("error code %d: lectura inicial fallida: %v", ErrInitialRead, err)
+        return PutSFTPFile(base64Data, ftpUrl, opts...)
     }
 
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return fmt.Errorf("error code %d: error enviando usuario: %v", ErrUserSend, err)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return fmt.Errorf("error code %d: autenticación de usuario fallida", ErrUserAuth)
-    }
+    return putFTP(ftpUrl, bytes.NewReader(data), "I", newConfig(opts))
+}
 
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return fmt.Errorf("error code %d: error enviando contraseña: %v", ErrPassSend, err)
+func PutFTPText(textData, ftpUrl string, opts ...Option) error {
+    if textData == "" {
+        return fmt.Errorf("error code %d: texto vacío", ErrEmptyData)
     }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return fmt.Errorf("error code %d: autenticación de contraseña fallida", ErrPassAuth)
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
-    if _, err = fmt.Fprintf(conn, "TYPE I\r\n"); err != nil {
-        return fmt.Errorf("error code %d: error configurando modo binario", ErrTypeCommand)
+    if isSFTP(ftpUrl) {
+        return PutSFTPText(textData, ftpUrl, opts...)
     }
-    conn.Read(buf[:])
 
-    if _, err = fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return fmt.Errorf("error code %d: error entrando en modo pasivo", ErrPasvMode)
-    }
-    n, err = conn.Read(buf[:])
+    cfg := newConfig(opts)
+    options, err := cfg.textOptions(ftpUrl)
     if err != nil {
-        return fmt.Errorf("error code %d: error leyendo respuesta PASV", ErrPasvMode)
+        return err
     }
-
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return fmt.Errorf("error code %d: error analizando modo pasivo: %v", ErrPasvMode, err)
+    if options != nil {
+        data, err := cfg.encodeText(options, textData, ftpUrl)
+        if err != nil {
+            return err
+        }
+        return putFTP(ftpUrl, bytes.NewReader(data), "I", cfg)
     }
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
-        return fmt.Errorf("error code %d: error conexión de datos: %v", ErrConnectionFailed, err)
-    }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
+    normalizedText := strings.ReplaceAll(textData, "\n", "\r\n")
+    return putFTP(ftpUrl, strings.NewReader(normalizedText), "A", cfg)
+}
 
-    if _, err = fmt.Fprintf(conn, "STOR %s\r\n", path); err != nil {
-        return fmt.Errorf("error code %d: error iniciando transferencia", ErrStorCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return fmt.Errorf("error code %d: error preparando servidor", ErrDataTransfer)
-    }
+// AppendFTPFile añade los datos en base64 al final del archivo remoto, que
+// se crea si no existe. Usa APPE en FTP y O_APPEND en SFTP. Si la subida se
+// corta, el reintento envía solo lo que falta; cuando no puede saber cuánto
+// llegó (sin SIZE o en modo texto) falla en lugar de duplicar datos.
+func AppendFTPFile(base64Data, ftpUrl string, opts ...Option) error {
+    return PutFTPFile(base64Data, ftpUrl, append(opts[:len(opts):len(opts)], appendMode())...)
+}
 
-    _, err = io.Copy(dataConn, bytes.NewReader(data))
-    if err != nil {
-        return fmt.Errorf("error code %d: error enviando datos: %v", ErrDataTransfer, err)
-    }
-    dataConn.Close()
+// AppendFTPText añade texto al final del archivo remoto, como AppendFTPFile.
+func AppendFTPText(textData, ftpUrl string, opts ...Option) error {
+    return PutFTPText(textData, ftpUrl, append(opts[:len(opts):len(opts)], appendMode())...)
+}
 
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return fmt.Errorf("error code %d: error confirmando transferencia", ErrTransferConfirm)
-    }
+// PutFTPFileUnique sube los datos en base64 con un nombre que elige el
+// servidor (STOU) y devuelve la ruta asignada. La URL indica el directorio
+// ("ftp://host/buzon/") o un nombre base que el servidor puede respetar. En
+// SFTP se emula creando con O_EXCL el primer nombre libre entre informe.csv,
+// informe.1.csv, informe.2.csv... Si la subida falla tras asignarse el nombre
+// también se devuelve, porque puede quedar un archivo parcial.
+func PutFTPFileUnique(base64Data, ftpUrl string, opts ...Option) (string, error) {
+    var name string
+    err := PutFTPFile(base64Data, ftpUrl, append(opts[:len(opts):len(opts)], uniqueName(&name))...)
+    return name, err
+}
 
-    return nil
+func CreateFTPDir(ftpUrl string, opts ...Option) error {
+    _, err := EnsureFTPDir(ftpUrl, opts...)
+    return err
 }
 
-func PutFTPText(textData, ftpUrl string) error {
-    if textData == "" {
-        return fmt.Errorf("error code %d: texto vacío", ErrEmptyData)
-    }
+// EnsureFTPDir crea el directorio de la URL e indica si ya existía.
+func EnsureFTPDir(ftpUrl string, opts ...Option) (bool, error) {
     if ftpUrl == "" {
-        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+        return false, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
     if isSFTP(ftpUrl) {
-        return PutSFTPText(textData, ftpUrl)
+        return ensureSFTPDir(ftpUrl, newConfig(opts))
     }
 
-    // Original FTP implementation
-    u, err := url.Parse(ftpUrl)
+    u, err := parseURL(ftpUrl, "ftp")
     if err != nil {
-        return fmt.Errorf("error analizando URL: %v", err)
+        return false, err
     }
-    if u.Scheme != "ftp" {
-        return fmt.Errorf("error code %d: URL no es FTP", ErrInvalidScheme)
+    path := strings.TrimPrefix(u.Path, "/")
+    if path == "" {
+        return false, fmt.Errorf("error code %d: falta path del directorio", ErrMissingPath)
     }
 
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
+    cfg := newConfig(opts)
+    existed := false
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    if host == "" || user == "" {
-        return fmt.Errorf("error code %d: falta host o usuario", ErrMissingHostUser)
-    }
+        existed, err = s.mkdir(path)
+        return err
+    })
+    return existed, err
+}
 
-    conn, err := net.DialTimeout("tcp", host, timeout)
+func ListFTPFiles(dirPath string, opts ...Option) []string {
+    files, err := ListFTPDir(dirPath, opts...)
     if err != nil {
-        return fmt.Errorf("error code %d: conexión fallida: %v", ErrConnectionFailed, err)
+        return nil
     }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
+    return files
+}
 
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
-    if err != nil {
-        return fmt.Errorf("error code %d: lectura inicial fallida: %v", ErrInitialRead, err)
+// ListFTPDir devuelve los nombres del directorio remoto, FTP o SFTP,
+// informando del error en lugar de devolver una lista vacía. En FTP usa MLSD
+// y, si el servidor no lo admite, LIST.
+func ListFTPDir(dirPath string, opts ...Option) ([]string, error) {
+    if dirPath == "" {
+        return nil, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return fmt.Errorf("error code %d: error enviando usuario: %v", ErrUserSend, err)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return fmt.Errorf("error code %d: autenticación de usuario fallida", ErrUserAuth)
+    if isSFTP(dirPath) {
+        return listSFTP(dirPath, newConfig(opts))
     }
 
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return fmt.Errorf("error code %d: error enviando contraseña: %v", ErrPassSend, err)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return fmt.Errorf("error code %d: autenticación de contraseña fallida", ErrPassAuth)
-    }
+    return listFTP(dirPath, newConfig(opts))
+}
 
-    if _, err = fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return fmt.Errorf("error code %d: error configurando modo ASCII", ErrAsciiMode)
+// GetFTPBytes descarga el archivo remoto, FTP o SFTP, sin codificarlo.
+func GetFTPBytes(ftpUrl string, opts ...Option) ([]byte, error) {
+    if ftpUrl == "" {
+        return nil, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
-    conn.Read(buf[:])
 
-    if _, err = fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return fmt.Errorf("error code %d: error entrando en modo pasivo", ErrPasvMode)
+    var buffer bufferSink
+    var err error
+    if isSFTP(ftpUrl) {
+        err = getSFTP(ftpUrl, &buffer, maxFileSize, newConfig(opts))
+    } else {
+        err = getFTP(ftpUrl, "I", &buffer, maxFileSize, newConfig(opts))
     }
-    n, err = conn.Read(buf[:])
     if err != nil {
-        return fmt.Errorf("error code %d: error leyendo respuesta PASV", ErrPasvMode)
+        return nil, err
     }
+    return buffer.Bytes(), nil
+}
 
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
-    if err != nil {
-        return fmt.Errorf("error code %d: error analizando modo pasivo: %v", ErrPasvMode, err)
+// ReadFTPText es GetFTPText con el error de la descarga, para distinguir un
+// archivo vacío ("" y nil) de un fallo.
+func ReadFTPText(ftpUrl string, opts ...Option) (string, error) {
+    if ftpUrl == "" {
+        return "", fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
+    cfg := newConfig(opts)
+    options, err := cfg.textOptions(ftpUrl)
     if err != nil {
-        return fmt.Errorf("error code %d: error conexión de datos: %v", ErrConnectionFailed, err)
-    }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
-
-    if _, err = fmt.Fprintf(conn, "STOR %s\r\n", path); err != nil {
-        return fmt.Errorf("error code %d: error iniciando transferencia", ErrStorCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return fmt.Errorf("error code %d: error preparando servidor", ErrDataTransfer)
+        return "", err
+    }
+    // Con TextOptions la conversión es local y el archivo se baja en binario
+    var buffer bufferSink
+    switch {
+    case isSFTP(ftpUrl):
+        err = getSFTP(ftpUrl, &buffer, maxFileSize, cfg)
+    case options != nil:
+        err = getFTP(ftpUrl, "I", &buffer, maxFileSize, cfg)
+    default:
+        err = getFTP(ftpUrl, "A", &buffer, maxFileSize, cfg)
     }
-
-    normalizedText := strings.ReplaceAll(textData, "\n", "\r\n")
-    _, err = fmt.Fprintf(dataConn, normalizedText)
     if err != nil {
-        return fmt.Errorf("error code %d: error enviando datos: %v", ErrDataTransfer, err)
+        return "", err
     }
-    dataConn.Close()
-
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return fmt.Errorf("error code %d: error confirmando transferencia", ErrTransferConfirm)
+    if options != nil {
+        return options.decode(buffer.Bytes()), nil
     }
 
-    return nil
+    text := buffer.String()
+    text = strings.ReplaceAll(text, "\r\n", "\n")
+    return strings.TrimSpace(text), nil
 }
 
-func CreateFTPDir(ftpUrl string) error {
+// PutFTPBytes sube data a la URL, FTP o SFTP, en modo binario.
+func PutFTPBytes(data []byte, ftpUrl string, opts ...Option) error {
     if ftpUrl == "" {
         return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
     if isSFTP(ftpUrl) {
-        return CreateSFTPDir(ftpUrl)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return fmt.Errorf("error analizando URL: %v", err)
-    }
-    if u.Scheme != "ftp" {
-        return fmt.Errorf("error code %d: URL no es FTP", ErrInvalidScheme)
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := strings.TrimPrefix(u.Path, "/")
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return fmt.Errorf("error code %d: falta host o usuario", ErrMissingHostUser)
-    }
-
-    if path == "" {
-        return fmt.Errorf("error code %d: falta path del directorio", ErrMissingPath)
+        return putSFTP(ftpUrl, bytes.NewReader(data), newConfig(opts))
     }
+    return putFTP(ftpUrl, bytes.NewReader(data), "I", newConfig(opts))
+}
 
-    conn, err := net.DialTimeout("tcp", host, timeout)
-    if err != nil {
-        return fmt.Errorf("error code %d: conexión fallida: %v", ErrConnectionFailed, err)
-    }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+// getSFTP descarga el archivo en dst con File.WriteTo, que lee en paralelo
+// según la configuración del cliente; un reintento continúa desde lo ya
+// recibido.
+func getSFTP(ftpUrl string, dst sink, limit int64, cfg *config) error {
+    u, err := parseURL(ftpUrl, "sftp")
     if err != nil {
-        return fmt.Errorf("error code %d: lectura inicial fallida: %v", ErrInitialRead, err)
-    }
-
-    if _, err = fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return fmt.Errorf("error code %d: error enviando usuario: %v", ErrUserSend, err)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return fmt.Errorf("error code %d: autenticación de usuario fallida", ErrUserAuth)
+        return err
     }
+    dst, digest := cfg.digestSink(dst)
+    dst, setTotal := cfg.trackSink(dst)
 
-    if _, err = fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return fmt.Errorf("error code %d: error enviando contraseña: %v", ErrPassSend, err)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return fmt.Errorf("error code %d: autenticación de contraseña fallida", ErrPassAuth)
-    }
+    err = cfg.do(func() (err error) {
+        client, release, err := cfg.openSFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    // Verificar si ya existe como archivo
-    if _, err = fmt.Fprintf(conn, "SIZE %s\r\n", path); err != nil {
-        return fmt.Errorf("error code %d: error enviando comando SIZE", ErrSizeCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return fmt.Errorf("error code %d: error leyendo respuesta SIZE", ErrSizeResponse)
-    }
-    sizeResp := string(buf[:n])
-    if strings.HasPrefix(sizeResp, "213") {
-        return fmt.Errorf("error code %d: ya existe como archivo (conflicto)", ErrFileConflict)
-    }
+        file, err := client.Open(u.Path)
+        if err != nil {
+            return sftpError(err, "failed to open file")
+        }
+        defer file.Close()
 
-    // Verificar si ya existe como directorio
-    if _, err = fmt.Fprintf(conn, "CWD %s\r\n", path); err != nil {
-        return fmt.Errorf("error code %d: error enviando comando CWD", ErrCwdCommand)
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
-        return fmt.Errorf("error code %d: error leyendo respuesta CWD", ErrCwdResponse)
-    }
-    cwdResp := string(buf[:n])
-    if strings.HasPrefix(cwdResp, "250") {
-        // Volver al directorio anterior
-        _, _ = fmt.Fprintf(conn, "CDUP\r\n")
-        return nil // Ya existe como directorio
-    }
+        stat, err := file.Stat()
+        if err != nil {
+            return sftpError(err, "failed to stat file")
+        }
+        if stat.Size() >= limit {
+            return errorf(ErrSftpOperation, "el archivo supera el límite de %d bytes", limit)
+        }
+        setTotal(stat.Size())
+
+        if offset := dst.offset(); offset > 0 {
+            if _, err := file.Seek(offset, io.SeekStart); err != nil {
+                if err := dst.reset(); err != nil {
+                    return wrapError(ErrSftpOperation, err, "no se puede reiniciar la descarga")
+                }
+            }
+        }
 
-    // Crear el directorio
-    if _, err = fmt.Fprintf(conn, "MKD %s\r\n", path); err != nil {
-        return fmt.Errorf("error code %d: error enviando comando MKD", ErrMkdirFailed)
-    }
-    n, err = conn.Read(buf[:])
+        if _, err := file.WriteTo(dst); err != nil {
+            return sftpError(err, "failed to read file")
+        }
+        // Las lecturas concurrentes asumen respuestas completas; un servidor
+        // que recorta paquetes mayores que su límite deja el archivo a medias
+        if stat.Mode().IsRegular() && dst.offset() < stat.Size() {
+            return errorf(ErrSftpOperation, "lectura incompleta (%d de %d bytes): el servidor no admite el tamaño de paquete", dst.offset(), stat.Size())
+        }
+        return nil
+    })
     if err != nil {
-        return fmt.Errorf("error code %d: error leyendo respuesta MKD", ErrMkdirResponse)
-    }
-    resp := string(buf[:n])
-    if !strings.HasPrefix(resp, "257") {
-        return fmt.Errorf("error code %d: error creando directorio", ErrMkdirFailed)
+        return err
     }
-
-    return nil
+    digest.finish()
+    return verify(u, cfg, dst.copyTo)
 }
 
-func ListFTPFiles(dirPath string) []string {
-    if dirPath == "" {
-        return nil
-    }
-
-    if isSFTP(dirPath) {
-        return ListSFTPFiles(dirPath)
-    }
-
-    // Original FTP implementation
-    u, err := url.Parse(dirPath)
-    if err != nil || u.Scheme != "ftp" {
-        return nil
-    }
-
-    user := u.User.Username()
-    pass, _ := u.User.Password()
-    host := u.Host
-    path := u.Path
-
-    if !strings.Contains(host, ":") {
-        host += ":21"
-    }
-
-    if host == "" || user == "" {
-        return nil
-    }
-
-    conn, err := net.DialTimeout("tcp", host, timeout)
+// putSFTP escribe src creando los directorios intermedios, con File.ReadFrom
+// para aprovechar las escrituras concurrentes. Si un intento secuencial se
+// corta tras escribir, el siguiente continúa desde el tamaño remoto. Al
+// anexar se escribe siempre en orden, de paquete en paquete.
+func putSFTP(ftpUrl string, src io.ReadSeeker, cfg *config) error {
+    u, err := parseURL(ftpUrl, "sftp")
     if err != nil {
-        return nil
+        return err
     }
-    defer conn.Close()
-    conn.SetDeadline(time.Now().Add(timeout))
-
-    var buf [1024]byte
-    n, err := conn.Read(buf[:])
+    total, err := sourceSize(src)
     if err != nil {
-        return nil
-    }
+        return wrapError(ErrSftpOperation, err, "error leyendo datos")
+    }
+    raw := src
+    src, digest := cfg.digestReader(src, total)
+    src = cfg.trackReader(src, total)
+    // Con escrituras concurrentes un corte puede dejar huecos en el archivo
+    // remoto, así que no se reanuda desde su tamaño
+    resumable := !cfg.sftp.concurrentWrites()
+
+    started, checked := false, cfg.appending || cfg.unique != nil
+    assigned := false // ya se eligió un nombre libre
+    base := int64(0)  // tamaño remoto antes de anexar
+    overwrite := overwriteMode(u, cfg)
+    err = cfg.do(func() (err error) {
+        client, release, err := cfg.openSFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    if _, err := fmt.Fprintf(conn, "USER %s\r\n", user); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "331") {
-        return nil
-    }
+        dir := filepath.Dir(u.Path)
+        if dir != "." && makeDirs(u, true) {
+            if err := client.MkdirAll(dir); err != nil {
+                return sftpError(err, "failed to create directories")
+            }
+        }
 
-    if _, err := fmt.Fprintf(conn, "PASS %s\r\n", pass); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "230") {
-        return nil
-    }
+        if !checked {
+            if err := checkSFTPOverwrite(client, overwrite, u.Path, total, cfg.modTime); err != nil {
+                return err
+            }
+        }
 
-    if _, err := fmt.Fprintf(conn, "TYPE A\r\n"); err != nil {
-        return nil
-    }
-    conn.Read(buf[:])
+        // El cierre explícito del final es el que informa del error; este
+        // solo libera el archivo si se sale antes
+        var file *sftp.File
+        defer func() {
+            if file != nil {
+                file.Close()
+            }
+        }()
+        offset := int64(0)
+        if cfg.appending {
+            file, err = client.OpenFile(u.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+            if err != nil {
+                return sftpError(err, "failed to open file")
+            }
+            stat, err := file.Stat()
+            if err != nil {
+                return sftpError(err, "failed to stat file")
+            }
+            if !started {
+                base = stat.Size()
+            } else if stat.Size() < base || (total >= 0 && stat.Size()-base > total) {
+                return errorf(ErrSftpOperation, "no se puede reanudar el anexado")
+            }
+            offset = stat.Size() - base
+            // Hay servidores que ignoran O_APPEND
+            if _, err := file.Seek(stat.Size(), io.SeekStart); err != nil {
+                return sftpError(err, "failed to seek file")
+            }
+        } else if started && resumable {
+            if stat, err := client.Stat(u.Path); err == nil && (total < 0 || stat.Size() <= total) {
+                offset = stat.Size()
+            }
+        }
+        switch {
+        case cfg.appending:
+        case cfg.unique != nil && !assigned:
+            var name string
+            file, name, err = createUnique(client, u.Path)
+            if err == nil {
+                u.Path, *cfg.unique, assigned = name, name, true
+            }
+        case !checked && overwrite == OverwriteNever:
+            file, err = client.OpenFile(u.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+            if err != nil {
+                if _, statErr := client.Stat(u.Path); statErr == nil {
+                    return errorf(ErrWriteRefused, "el archivo remoto ya existe")
+                }
+            }
+        case offset > 0:
+            file, err = client.OpenFile(u.Path, os.O_WRONLY)
+            if err == nil {
+                _, err = file.Seek(offset, io.SeekStart)
+            }
+        default:
+            file, err = client.Create(u.Path)
+        }
+        if err != nil {
+            return sftpError(err, "failed to create file")
+        }
+        checked = true
 
-    if _, err := fmt.Fprintf(conn, "PASV\r\n"); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil {
+        if _, err := src.Seek(offset, io.SeekStart); err != nil {
+            return wrapError(ErrSftpOperation, err, "error leyendo datos")
+        }
+        var n int64
+        if cfg.appending {
+            // Sin ReadFrom ni WriteTo cada Write es un solo paquete
+            buf := make([]byte, cfg.sftp.packetSize())
+            n, err = io.CopyBuffer(struct{ io.Writer }{file}, struct{ io.Reader }{src}, buf)
+        } else {
+            n, err = file.ReadFrom(src)
+        }
+        if n > 0 {
+            started = true
+        }
+        if err != nil {
+            return sftpError(err, "failed to write file")
+        }
+        closeErr := file.Close()
+        file = nil
+        if closeErr != nil {
+            return sftpError(closeErr, "failed to write file")
+        }
         return nil
-    }
-
-    pasvResp := string(buf[:n])
-    dataAddr, err := parsePASV(pasvResp)
+    })
     if err != nil {
-        return nil
+        return err
     }
-
-    dataConn, err := net.DialTimeout("tcp", dataAddr, timeout)
-    if err != nil {
+    digest.finish()
+    if cfg.appending {
         return nil
     }
-    defer dataConn.Close()
-    dataConn.SetDeadline(time.Now().Add(timeout))
+    return verify(u, cfg, copySource(raw))
+}
 
-    if _, err := fmt.Fprintf(conn, "LIST %s\r\n", path); err != nil {
-        return nil
-    }
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "150") {
-        return nil
+// createUnique crea con O_EXCL el primer nombre libre entre p, nombre.1.ext,
+// nombre.2.ext... Si p es un directorio ("/buzon/") usa un nombre aleatorio.
+func createUnique(client *sftp.Client, p string) (*sftp.File, string, error) {
+    dir, name := path.Split(p)
+    if name == "" {
+        random := make([]byte, 8)
+        if _, err := rand.Read(random); err != nil {
+            return nil, "", err
+        }
+        name = hex.EncodeToString(random)
+    }
+    ext := path.Ext(name)
+    stem := strings.TrimSuffix(name, ext)
+    for i := 0; i < 1000; i++ {
+        candidate := path.Join(dir, name)
+        if i > 0 {
+            candidate = path.Join(dir, fmt.Sprintf("%s.%d%s", stem, i, ext))
+        }
+        file, err := client.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+        if err == nil {
+            return file, candidate, nil
+        }
+        // Solo se prueba otro nombre si este existe
+        if _, statErr := client.Stat(candidate); statErr != nil {
+            return nil, "", err
+        }
     }
+    return nil, "", errorf(ErrWriteRefused, "no hay un nombre libre para %s", p)
+}
 
-    var buffer bytes.Buffer
-    limitedReader := &io.LimitedReader{R: dataConn, N: maxFileSize}
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return nil
+func ensureSFTPDir(ftpUrl string, cfg *config) (bool, error) {
+    u, err := parseURL(ftpUrl, "sftp")
+    if err != nil {
+        return false, err
     }
 
-    dataConn.Close()
-    n, err = conn.Read(buf[:])
-    if err != nil || !strings.HasPrefix(string(buf[:n]), "226") {
-        return nil
+    path := strings.TrimPrefix(u.Path, "/")
+    if path == "" {
+        return false, fmt.Errorf("error code %d: falta path del directorio", ErrMissingPath)
     }
 
-    lines := strings.Split(buffer.String(), "\n")
-    var files []string
-    for _, line := range lines {
-        line = strings.TrimSpace(line)
-        if line == "" {
-            continue
+    existed := false
+    err = cfg.do(func() (err error) {
+        client, release, err := cfg.openSFTP(u)
+        if err != nil {
+            return err
         }
-        parts := strings.Fields(line)
-        if len(parts) > 0 {
-            files = append(files, parts[len(parts)-1])
+        defer func() { release(err) }()
+
+        if stat, err := client.Stat(path); err == nil {
+            if !stat.IsDir() {
+                return fmt.Errorf("error code %d: ya existe como archivo (conflicto)", ErrFileConflict)
+            }
+            existed = true
+            return nil
         }
-    }
 
-    return files
+        if err := client.MkdirAll(path); err != nil {
+            return fmt.Errorf("error code %d: error creando directorio: %v", ErrMkdirFailed, err)
+        }
+        return nil
+    })
+    return existed, err
 }
 
-
-
-
-
-
-
-
-
-
-
-func GetSFTPFile(ftpUrl string) string {
+func GetSFTPFile(ftpUrl string, opts ...Option) string {
     if ftpUrl == "" {
         return ""
     }
 
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return ""
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return ""
-    }
-
-    file, err := client.Open(u.Path)
-    if err != nil {
-        return ""
-    }
-    defer file.Close()
-
-    limitedReader := &io.LimitedReader{R: file, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
-        return ""
-    }
-
-    if buffer.Len() == 0 {
+    var buffer bufferSink
+    if err := getSFTP(ftpUrl, &buffer, maxFileSize, newConfig(opts)); err != nil || buffer.Len() == 0 {
         return ""
     }
 
     return base64.StdEncoding.EncodeToString(buffer.Bytes())
 }
 
-func GetSFTPText(ftpUrl string) string {
+func GetSFTPText(ftpUrl string, opts ...Option) string {
     if ftpUrl == "" {
         return ""
     }
 
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return ""
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return ""
-    }
-
-    file, err := client.Open(u.Path)
+    cfg := newConfig(opts)
+    options, err := cfg.textOptions(ftpUrl)
     if err != nil {
         return ""
     }
-    defer file.Close()
-
-    limitedReader := &io.LimitedReader{R: file, N: maxFileSize}
-    var buffer bytes.Buffer
-    if _, err := io.Copy(&buffer, limitedReader); err != nil {
+    var buffer bufferSink
+    if err := getSFTP(ftpUrl, &buffer, maxFileSize, cfg); err != nil || buffer.Len() == 0 {
         return ""
     }
-
-    if buffer.Len() == 0 {
-        return ""
+    if options != nil {
+        return options.decode(buffer.Bytes())
     }
 
     text := buffer.String()
@@ -877,7 +948,7 @@ func GetSFTPText(ftpUrl string) string {
     return strings.TrimSpace(text)
 }
 
-func PutSFTPFile(base64Data, ftpUrl string) error {
+func PutSFTPFile(base64Data, ftpUrl string, opts ...Option) error {
     if base64Data == "" {
         return fmt.Errorf("error code %d: datos vacíos", ErrEmptyData)
     }
@@ -890,39 +961,10 @@ func PutSFTPFile(base64Data, ftpUrl string) error {
         return fmt.Errorf("error decodificando base64: %v", err)
     }
 
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return err
-    }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return err
-    }
-
-    dir := filepath.Dir(u.Path)
-    if dir != "." {
-        if err := client.MkdirAll(dir); err != nil {
-            return fmt.Errorf("error code %d: failed to create directories: %v", ErrSftpOperation, err)
-        }
-    }
-
-    file, err := client.Create(u.Path)
-    if err != nil {
-        return fmt.Errorf("error code %d: failed to create file: %v", ErrSftpOperation, err)
-    }
-    defer file.Close()
-
-    if _, err := file.Write(data); err != nil {
-        return fmt.Errorf("error code %d: failed to write file: %v", ErrSftpOperation, err)
-    }
-
-    return nil
+    return putSFTP(ftpUrl, bytes.NewReader(data), newConfig(opts))
 }
 
-func PutSFTPText(textData, ftpUrl string) error {
+func PutSFTPText(textData, ftpUrl string, opts ...Option) error {
     if textData == "" {
         return fmt.Errorf("error code %d: texto vacío", ErrEmptyData)
     }
@@ -930,101 +972,101 @@ func PutSFTPText(textData, ftpUrl string) error {
         return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
-    client, conn, err := createSFTPClient(ftpUrl)
+    cfg := newConfig(opts)
+    options, err := cfg.textOptions(ftpUrl)
     if err != nil {
         return err
     }
-    defer client.Close()
-    defer conn.Close()
-
-    u, err := url.Parse(ftpUrl)
-    if err != nil {
-        return err
-    }
-
-    dir := filepath.Dir(u.Path)
-    if dir != "." {
-        if err := client.MkdirAll(dir); err != nil {
-            return fmt.Errorf("error code %d: failed to create directories: %v", ErrSftpOperation, err)
+    if options != nil {
+        data, err := cfg.encodeText(options, textData, ftpUrl)
+        if err != nil {
+            return err
         }
+        return putSFTP(ftpUrl, bytes.NewReader(data), cfg)
     }
 
-    file, err := client.Create(u.Path)
-    if err != nil {
-        return fmt.Errorf("error code %d: failed to create file: %v", ErrSftpOperation, err)
-    }
-    defer file.Close()
-
     normalizedText := strings.ReplaceAll(strings.ReplaceAll(textData, "\r\n", "\n"), "\n", "\r\n")
-    if _, err := fmt.Fprint(file, normalizedText); err != nil {
-        return fmt.Errorf("error code %d: failed to write file: %v", ErrSftpOperation, err)
-    }
-
-    return nil
+    return putSFTP(ftpUrl, strings.NewReader(normalizedText), cfg)
 }
 
-func CreateSFTPDir(ftpUrl string) error {
+func CreateSFTPDir(ftpUrl string, opts ...Option) error {
     if ftpUrl == "" {
         return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
     }
 
-    client, conn, err := createSFTPClient(ftpUrl)
-    if err != nil {
-        return err
+    _, err := ensureSFTPDir(ftpUrl, newConfig(opts))
+    return err
+}
+
+func ListSFTPFiles(dirPath string, opts ...Option) []string {
+    if dirPath == "" {
+        return nil
     }
-    defer client.Close()
-    defer conn.Close()
 
-    u, err := url.Parse(ftpUrl)
+    files, err := listSFTP(dirPath, newConfig(opts))
     if err != nil {
-        return err
+        return nil
     }
+    return files
+}
 
-    path := strings.TrimPrefix(u.Path, "/")
-    if path == "" {
-        return fmt.Errorf("error code %d: falta path del directorio", ErrMissingPath)
+func listSFTP(dirPath string, cfg *config) ([]string, error) {
+    u, err := parseURL(dirPath, "sftp")
+    if err != nil {
+        return nil, err
     }
 
-    if stat, err := client.Stat(path); err == nil {
-        if !stat.IsDir() {
-            return fmt.Errorf("error code %d: ya existe como archivo (conflicto)", ErrFileConflict)
+    var fileNames []string
+    err = cfg.do(func() (err error) {
+        client, release, err := cfg.openSFTP(u)
+        if err != nil {
+            return err
         }
-        return nil
-    }
-
-    if err := client.MkdirAll(path); err != nil {
-        return fmt.Errorf("error code %d: error creando directorio: %v", ErrMkdirFailed, err)
-    }
+        defer func() { release(err) }()
 
-    return nil
-}
+        files, err := client.ReadDir(u.Path)
+        if err != nil {
+            return sftpError(err, "failed to read directory")
+        }
 
-func ListSFTPFiles(dirPath string) []string {
-    if dirPath == "" {
+        fileNames = nil
+        for _, file := range files {
+            fileNames = append(fileNames, file.Name())
+        }
         return nil
-    }
-
-    client, conn, err := createSFTPClient(dirPath)
+    })
     if err != nil {
-        return nil
+        return nil, err
     }
-    defer client.Close()
-    defer conn.Close()
 
-    u, err := url.Parse(dirPath)
-    if err != nil {
-        return nil
-    }
+    return fileNames, nil
+}
 
-    files, err := client.ReadDir(u.Path)
+// GetFTPFeatures devuelve las extensiones que anuncia el servidor FTP con
+// FEAT y sus parámetros, por ejemplo "MLST" -> "type*;size*;modify*;". Un
+// servidor sin FEAT devuelve un mapa vacío.
+func GetFTPFeatures(ftpUrl string, opts ...Option) (map[string]string, error) {
+    if ftpUrl == "" {
+        return nil, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    u, err := parseURL(ftpUrl, "ftp")
     if err != nil {
-        return nil
+        return nil, err
     }
 
-    var fileNames []string
-    for _, file := range files {
-        fileNames = append(fileNames, file.Name())
-    }
+    cfg := newConfig(opts)
+    features := map[string]string{}
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
 
-    return fileNames
+        for name, params := range s.features {
+            features[name] = params
+        }
+        return nil
+    })
+    return features, err
 }
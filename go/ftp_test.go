@@ -0,0 +1,130 @@
+package ftp
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+func TestReadFTPTextEmpty(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    mem := server.NewMemFS()
+    mem.WriteFile("/vacio.txt", nil)
+    mem.WriteFile("/texto.txt", []byte("  hola\nmundo\n"))
+    ftpSrv, err := server.Start(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ftpSrv.Close()
+    sftpSrv, err := server.StartSFTP(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer sftpSrv.Close()
+
+    for _, url := range []func(user, pass, path string) string{ftpSrv.URL, sftpSrv.URL} {
+        if text, err := ReadFTPText(url("u", "p", "/vacio.txt")); text != "" || err != nil {
+            t.Errorf("archivo vacío: %q, %v", text, err)
+        }
+        if text, err := ReadFTPText(url("u", "p", "/texto.txt")); text != "hola\nmundo" || err != nil {
+            t.Errorf("texto: %q, %v", text, err)
+        }
+        if text, err := ReadFTPText(url("u", "p", "/texto.txt") + "?trim=0"); text != "  hola\nmundo\n" || err != nil {
+            t.Errorf("texto sin recortar: %q, %v", text, err)
+        }
+        if _, err := ReadFTPText(url("u", "p", "/no-existe.txt")); err == nil {
+            t.Errorf("archivo inexistente sin error")
+        }
+        if data, err := GetFTPBytes(url("u", "p", "/vacio.txt")); len(data) != 0 || err != nil {
+            t.Errorf("bytes de archivo vacío: %q, %v", data, err)
+        }
+    }
+}
+
+func TestParseURLPath(t *testing.T) {
+    cases := []struct {
+        url  string
+        path string
+        code int
+    }{
+        {"ftp://u:p@servidor/informes/enero%20%232.csv", "/informes/enero #2.csv", 0},
+        {"ftp://u:p@servidor/a/b%3Fc.txt", "/a/b?c.txt", 0},
+        {"ftp://u:p@servidor/a/100%25.txt", "/a/100%.txt", 0},
+        {"ftp://u:p@servidor/a/%252F.txt", "/a/%2F.txt", 0},
+        {"ftp://u:p@servidor/a%2Fb.txt", "", ErrInvalidPath},
+        {"ftp://u:p@servidor/a%2fb/c.txt", "", ErrInvalidPath},
+        {"ftp://u:p@servidor/a#b.txt", "", ErrInvalidPath},
+        {"ftp://u:p@servidor/a%0D%0ADELE%20b", "", ErrInvalidPath},
+        {"sftp://u:p@servidor/a.txt", "", ErrInvalidScheme},
+    }
+    for _, c := range cases {
+        u, err := parseURL(c.url, "ftp")
+        if code := ErrorCode(err); code != c.code {
+            t.Errorf("%s: código %d, se esperaba %d (%v)", c.url, code, c.code, err)
+            continue
+        }
+        if err == nil && u.Path != c.path {
+            t.Errorf("%s: ruta %q, se esperaba %q", c.url, u.Path, c.path)
+        }
+    }
+}
+
+func TestGetFTPLimit(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", make([]byte, 1000))
+    srv, err := server.Start(mem, map[string]string{"u": "p"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    var buffer bufferSink
+    err = getFTP(srv.URL("u", "p", "/a.bin"), "I", &buffer, 100, newConfig(nil))
+    if ErrorCode(err) != ErrDataTransfer || !strings.Contains(err.Error(), "límite de 100 bytes") {
+        t.Fatalf("límite: %v", err)
+    }
+}
+
+func TestAppendTextBOM(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    mem := server.NewMemFS()
+    ftpSrv, err := server.Start(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ftpSrv.Close()
+    sftpSrv, err := server.StartSFTP(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer sftpSrv.Close()
+
+    cases := []struct {
+        query string
+        bom   string
+    }{
+        {"?encoding=utf-16", "\xff\xfe"},
+        {"?bom=add", "\xef\xbb\xbf"},
+    }
+    for _, url := range []func(user, pass, path string) string{ftpSrv.URL, sftpSrv.URL} {
+        for _, c := range cases {
+            mem.WriteFile("/vacio.txt", nil)
+            for _, name := range []string{"/nuevo.txt", "/vacio.txt"} {
+                mem.Remove("/nuevo.txt")
+                for _, text := range []string{"hola\n", "\ufeffmundo\n"} {
+                    if err := AppendFTPText(text, url("u", "p", name)+c.query); err != nil {
+                        t.Fatalf("%s%s: %v", name, c.query, err)
+                    }
+                }
+                data, _ := mem.ReadFile(name)
+                if !strings.HasPrefix(string(data), c.bom) || strings.Count(string(data), c.bom) != 1 {
+                    t.Errorf("%s%s: se esperaba una sola BOM al principio: % x", name, c.query, data)
+                }
+                if text, err := ReadFTPText(url("u", "p", name) + c.query); text != "hola\nmundo" || err != nil {
+                    t.Errorf("%s%s: %q, %v", name, c.query, text, err)
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,373 @@
+package ftp
+
+import (
+    "fmt"
+    "net/url"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// FileInfo describe una entrada remota.
+type FileInfo struct {
+    Name    string    `json:"name"`
+    Size    int64     `json:"size"`
+    ModTime time.Time `json:"modified,omitzero"`
+    IsDir   bool      `json:"dir"`
+}
+
+// parseFTPTime interpreta las fechas de MDTM y MLST (YYYYMMDDHHMMSS[.sss], UTC).
+func parseFTPTime(value string) (time.Time, error) {
+    if len(value) < 14 {
+        return time.Time{}, errorf(ErrDataTransfer, "fecha inválida: %s", value)
+    }
+    t, err := time.Parse("20060102150405", value[:14])
+    if err != nil {
+        return time.Time{}, wrapError(ErrDataTransfer, err, "fecha inválida")
+    }
+    return t, nil
+}
+
+// parseFacts interpreta una línea de MLSD o MLST: "type=file;size=3; nombre".
+// Devuelve también el valor de type en minúsculas, que distingue el propio
+// directorio (cdir) y el padre (pdir) de las entradas con ese nombre.
+func parseFacts(line string) (FileInfo, string, bool) {
+    facts, name, ok := strings.Cut(strings.TrimLeft(line, " "), " ")
+    if !ok || !strings.Contains(facts, "=") || name == "" {
+        return FileInfo{}, "", false
+    }
+
+    info := FileInfo{Name: path.Base(name)}
+    var kind string
+    for _, fact := range strings.Split(facts, ";") {
+        key, value, _ := strings.Cut(fact, "=")
+        switch strings.ToLower(key) {
+        case "type":
+            kind = strings.ToLower(value)
+            info.IsDir = kind == "dir" || kind == "cdir" || kind == "pdir"
+        case "size":
+            info.Size, _ = strconv.ParseInt(value, 10, 64)
+        case "modify":
+            info.ModTime, _ = parseFTPTime(value)
+        }
+    }
+    return info, kind, true
+}
+
+// listMLSD lista dir con MLSD sin el propio directorio ni el padre. Un
+// servidor que no admite MLSD responde 500, 501 o 502.
+func (s *ftpSession) listMLSD(dir string) ([]FileInfo, error) {
+    lines, err := s.list("MLSD", dir)
+    if err != nil {
+        return nil, err
+    }
+    var entries []FileInfo
+    for _, line := range lines {
+        if info, kind, ok := parseFacts(line); ok && kind != "cdir" && kind != "pdir" {
+            entries = append(entries, info)
+        }
+    }
+    return entries, nil
+}
+
+// mlsdUnsupported indica si err es el rechazo de MLSD o MLST por no
+// implementarlo, tras el que se recurre a LIST.
+func mlsdUnsupported(err error) bool {
+    reply := ReplyCode(err)
+    return reply == 500 || reply == 501 || reply == 502
+}
+
+// parseListLine interpreta una línea de LIST en formato Unix (ls -l) o DOS.
+func parseListLine(line string) (FileInfo, bool) {
+    fields := strings.Fields(line)
+
+    // DOS: 01-02-06  03:04PM  <DIR>  nombre
+    if len(fields) >= 4 && strings.Count(fields[0], "-") == 2 && strings.Contains(fields[1], ":") {
+        info := FileInfo{Name: strings.Join(fields[3:], " ")}
+        if fields[2] == "<DIR>" {
+            info.IsDir = true
+        } else {
+            info.Size, _ = strconv.ParseInt(fields[2], 10, 64)
+        }
+        info.ModTime, _ = time.Parse("01-02-06 03:04PM", fields[0]+" "+fields[1])
+        return info, true
+    }
+
+    // Unix: drwxr-xr-x 2 usuario grupo 4096 Jan  2 15:04 nombre
+    if len(fields) < 9 || len(fields[0]) < 10 {
+        return FileInfo{}, false
+    }
+    info := FileInfo{IsDir: fields[0][0] == 'd'}
+    info.Size, _ = strconv.ParseInt(fields[4], 10, 64)
+
+    // El nombre puede tener espacios: es el resto de la línea tras la fecha
+    rest := line
+    for i := 0; i < 8; i++ {
+        rest = strings.TrimLeft(rest, " ")
+        rest = rest[strings.IndexByte(rest, ' ')+1:]
+    }
+    info.Name = strings.TrimLeft(rest, " ")
+    if fields[0][0] == 'l' {
+        info.Name, _, _ = strings.Cut(info.Name, " -> ")
+    }
+
+    stamp := strings.Join(fields[5:8], " ")
+    if t, err := time.Parse("Jan _2 15:04", stamp); err == nil {
+        now := time.Now().UTC()
+        info.ModTime = t.AddDate(now.Year(), 0, 0)
+        if info.ModTime.After(now.AddDate(0, 0, 1)) {
+            info.ModTime = info.ModTime.AddDate(-1, 0, 0)
+        }
+    } else {
+        info.ModTime, _ = time.Parse("Jan _2 2006", stamp)
+    }
+    return info, info.Name != ""
+}
+
+// StatFTPFile devuelve los datos de la entrada remota. En FTP usa MLST y, si
+// el servidor no lo admite, SIZE, MDTM y CWD.
+func StatFTPFile(ftpUrl string, opts ...Option) (FileInfo, error) {
+    if ftpUrl == "" {
+        return FileInfo{}, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    return statFile(ftpUrl, newConfig(opts))
+}
+
+// statFile es StatFTPFile con la configuración ya resuelta.
+func statFile(ftpUrl string, cfg *config) (FileInfo, error) {
+    var info FileInfo
+    if isSFTP(ftpUrl) {
+        u, err := parseURL(ftpUrl, "sftp")
+        if err != nil {
+            return info, err
+        }
+        err = cfg.do(func() (err error) {
+            client, release, err := cfg.openSFTP(u)
+            if err != nil {
+                return err
+            }
+            defer func() { release(err) }()
+
+            stat, err := client.Stat(u.Path)
+            if err != nil {
+                return sftpError(err, "failed to stat file")
+            }
+            info = FileInfo{Name: stat.Name(), Size: stat.Size(), ModTime: stat.ModTime(), IsDir: stat.IsDir()}
+            return nil
+        })
+        return info, err
+    }
+
+    u, err := parseURL(ftpUrl, "ftp")
+    if err != nil {
+        return info, err
+    }
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
+
+        if s.supports("MLST") {
+            info, err = s.mlst(u.Path)
+            if err == nil {
+                info.Name = path.Base(u.Path)
+                return nil
+            }
+            if !mlsdUnsupported(err) {
+                return err
+            }
+        }
+
+        info = FileInfo{Name: path.Base(u.Path)}
+        if err := s.setType("I"); err != nil {
+            return err
+        }
+        if size, err := s.size(u.Path); err == nil {
+            info.Size = size
+            info.ModTime, _ = s.mdtm(u.Path)
+            return nil
+        }
+        isDir, err := s.isDir(u.Path)
+        if err != nil {
+            return err
+        }
+        if !isDir {
+            return errorf(ErrSizeResponse, "no existe %s", u.Path)
+        }
+        info.IsDir = true
+        return nil
+    })
+    return info, err
+}
+
+// ReadFTPDir devuelve las entradas del directorio remoto con su tipo, tamaño
+// y fecha. En FTP usa MLSD y, si el servidor no lo admite, LIST.
+func ReadFTPDir(dirPath string, opts ...Option) ([]FileInfo, error) {
+    if dirPath == "" {
+        return nil, fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    cfg := newConfig(opts)
+
+    var entries []FileInfo
+    if isSFTP(dirPath) {
+        u, err := parseURL(dirPath, "sftp")
+        if err != nil {
+            return nil, err
+        }
+        err = cfg.do(func() (err error) {
+            client, release, err := cfg.openSFTP(u)
+            if err != nil {
+                return err
+            }
+            defer func() { release(err) }()
+
+            files, err := client.ReadDir(u.Path)
+            if err != nil {
+                return sftpError(err, "failed to read directory")
+            }
+            entries = nil
+            for _, f := range files {
+                entries = append(entries, FileInfo{Name: f.Name(), Size: f.Size(), ModTime: f.ModTime(), IsDir: f.IsDir()})
+            }
+            return nil
+        })
+        return entries, err
+    }
+
+    u, err := parseURL(dirPath, "ftp")
+    if err != nil {
+        return nil, err
+    }
+    err = cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
+
+        if err := s.setType("A"); err != nil {
+            return err
+        }
+        entries = nil
+        if s.supports("MLST") {
+            entries, err = s.listMLSD(u.Path)
+            if err == nil || !mlsdUnsupported(err) {
+                return err
+            }
+        }
+
+        lines, err := s.list("LIST", u.Path)
+        if err != nil {
+            return err
+        }
+        for _, line := range lines {
+            if info, ok := parseListLine(line); ok && info.Name != "." && info.Name != ".." {
+                entries = append(entries, info)
+            }
+        }
+        return nil
+    })
+    return entries, err
+}
+
+// DeleteFTPFile elimina el archivo o directorio vacío de la URL.
+func DeleteFTPFile(ftpUrl string, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    cfg := newConfig(opts)
+
+    if isSFTP(ftpUrl) {
+        u, err := parseURL(ftpUrl, "sftp")
+        if err != nil {
+            return err
+        }
+        return cfg.do(func() (err error) {
+            client, release, err := cfg.openSFTP(u)
+            if err != nil {
+                return err
+            }
+            defer func() { release(err) }()
+
+            if err := client.Remove(u.Path); err != nil {
+                return sftpError(err, "failed to remove file")
+            }
+            return nil
+        })
+    }
+
+    u, err := parseURL(ftpUrl, "ftp")
+    if err != nil {
+        return err
+    }
+    return cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
+        return s.dele(u.Path)
+    })
+}
+
+// RenameFTPFile mueve la entrada de la URL a target, que puede ser una ruta
+// absoluta, un nombre relativo a su directorio o una URL del mismo servidor.
+func RenameFTPFile(ftpUrl, target string, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    if target == "" {
+        return fmt.Errorf("error code %d: falta el destino", ErrMissingPath)
+    }
+
+    scheme := "ftp"
+    if isSFTP(ftpUrl) {
+        scheme = "sftp"
+    }
+    u, err := parseURL(ftpUrl, scheme)
+    if err != nil {
+        return err
+    }
+    to := target
+    if t, err := url.Parse(target); err == nil && t.Scheme != "" {
+        t, err := parseURL(target, t.Scheme)
+        if err != nil {
+            return err
+        }
+        if t.Scheme != u.Scheme || t.Host != u.Host {
+            return errorf(ErrInvalidScheme, "el destino debe estar en el mismo servidor")
+        }
+        to = t.Path
+    } else if strings.ContainsAny(to, "\r\n\x00") {
+        return errorf(ErrInvalidPath, "ruta con caracteres de control")
+    } else if !strings.HasPrefix(to, "/") {
+        to = path.Join(path.Dir(u.Path), to)
+    }
+
+    cfg := newConfig(opts)
+    if scheme == "sftp" {
+        return cfg.do(func() (err error) {
+            client, release, err := cfg.openSFTP(u)
+            if err != nil {
+                return err
+            }
+            defer func() { release(err) }()
+
+            if err := client.Rename(u.Path, to); err != nil {
+                return sftpError(err, "failed to rename file")
+            }
+            return nil
+        })
+    }
+    return cfg.do(func() (err error) {
+        s, release, err := cfg.openFTP(u)
+        if err != nil {
+            return err
+        }
+        defer func() { release(err) }()
+        return s.rename(u.Path, to)
+    })
+}
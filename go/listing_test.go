@@ -0,0 +1,81 @@
+package ftp
+
+import (
+    "reflect"
+    "sort"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+func TestParseFacts(t *testing.T) {
+    cases := []struct {
+        line string
+        info FileInfo
+        kind string
+    }{
+        {"type=file;size=3;modify=20240102030405; a.txt", FileInfo{Name: "a.txt", Size: 3, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, "file"},
+        {"Type=DIR;Modify=20240102030405.123; sub dir", FileInfo{Name: "sub dir", IsDir: true, ModTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, "dir"},
+        {"type=cdir; /home/u", FileInfo{Name: "u", IsDir: true}, "cdir"},
+        {"type=pdir; ..", FileInfo{Name: "..", IsDir: true}, "pdir"},
+        // Archivos reales que se llaman como los tipos especiales
+        {"type=file;size=1; cdir", FileInfo{Name: "cdir", Size: 1}, "file"},
+        {"type=dir; pdir", FileInfo{Name: "pdir", IsDir: true}, "dir"},
+    }
+    for _, c := range cases {
+        info, kind, ok := parseFacts(c.line)
+        if !ok || info != c.info || kind != c.kind {
+            t.Errorf("%q: %+v %q %v", c.line, info, kind, ok)
+        }
+    }
+    if _, _, ok := parseFacts("sin hechos"); ok {
+        t.Error("línea sin hechos aceptada")
+    }
+}
+
+func TestListFTPDir(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.Mkdir("/d")
+    mem.Mkdir("/d/pdir")
+    for _, name := range []string{"/d/cdir", "/d/con espacios.txt", "/d/b.txt"} {
+        mem.WriteFile(name, []byte("x"))
+    }
+    // Un servidor por caso: los fallos se fijan antes de Listen
+    start := func(faults ...server.Fault) *server.Server {
+        srv := server.New(mem, map[string]string{"u": "p"})
+        srv.Faults = faults
+        if err := srv.Listen("127.0.0.1:0"); err != nil {
+            t.Fatal(err)
+        }
+        t.Cleanup(func() { srv.Close() })
+        return srv
+    }
+    want := []string{"b.txt", "cdir", "con espacios.txt", "pdir"}
+
+    // Con MLSD no hace falta LIST
+    srv := start(server.Fault{Command: "LIST", Reply: "500 LIST desactivado"})
+    names, err := ListFTPDir(srv.URL("u", "p", "/d"))
+    sort.Strings(names)
+    if err != nil || !reflect.DeepEqual(names, want) {
+        t.Errorf("MLSD: %q, %v", names, err)
+    }
+    entries, err := ReadFTPDir(srv.URL("u", "p", "/d"))
+    if err != nil || len(entries) != len(want) {
+        t.Errorf("ReadFTPDir: %+v, %v", entries, err)
+    }
+
+    // Sin MLSD se interpreta LIST
+    srv = start(server.Fault{Command: "MLSD", Reply: "502 MLSD no implementado"})
+    names, err = ListFTPDir(srv.URL("u", "p", "/d"))
+    sort.Strings(names)
+    if err != nil || !reflect.DeepEqual(names, want) {
+        t.Errorf("LIST: %q, %v", names, err)
+    }
+
+    // Otros errores de MLSD no se ocultan con LIST
+    srv = start(server.Fault{Command: "MLSD", Reply: "550 Sin permiso"})
+    if _, err := ListFTPDir(srv.URL("u", "p", "/d")); ReplyCode(err) != 550 {
+        t.Errorf("MLSD 550: %v", err)
+    }
+}
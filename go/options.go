@@ -0,0 +1,93 @@
+package ftp
+
+import (
+    "context"
+    "time"
+)
+
+// Option ajusta el comportamiento de una llamada concreta.
+type Option func(*config)
+
+type config struct {
+    retry RetryPolicy
+    pool  *Pool
+    sftp  SFTPTuning
+    ctx   context.Context
+
+    progress  func(done, total int64)
+    verify    string       // algoritmo de WithVerify
+    digests   *Digests     // destino de WithDigests
+    appending bool         // añadir al final en lugar de reemplazar
+    unique    *string      // ruta que asigna STOU, ver PutFTPFileUnique
+    overwrite Overwrite    // modo de WithOverwrite
+    modTime   time.Time    // fecha del archivo local, cero si no hay
+    text      *TextOptions // opciones de WithText
+    compress  string       // formato de WithCompression
+    modeZ     bool         // pedir MODE Z, ver WithModeZ
+}
+
+func newConfig(opts []Option) *config {
+    cfg := &config{
+        retry: currentRetryPolicy(),
+        pool:  currentPool(),
+        sftp:  currentSFTPTuning(),
+        ctx:   context.Background(),
+    }
+    for _, opt := range opts {
+        opt(cfg)
+    }
+    return cfg
+}
+
+// do ejecuta op con la política de reintentos y el contexto de la llamada.
+func (cfg *config) do(op func() error) error {
+    return cfg.retry.do(cfg.ctx, op)
+}
+
+// appendMode hace que las subidas añadan al final del archivo remoto.
+func appendMode() Option {
+    return func(cfg *config) {
+        cfg.appending = true
+    }
+}
+
+// uniqueName hace que las subidas usen un nombre nuevo y lo dejen en name.
+func uniqueName(name *string) Option {
+    return func(cfg *config) {
+        cfg.unique = name
+    }
+}
+
+// WithContext permite cancelar la operación: al cancelarse ctx se cierran sus
+// conexiones y la llamada falla con ErrCanceled. Los clientes SFTP de un Pool
+// son compartidos, así que no se cierran y la cancelación espera a que termine
+// la petición en curso.
+func WithContext(ctx context.Context) Option {
+    return func(cfg *config) {
+        if ctx != nil {
+            cfg.ctx = ctx
+        }
+    }
+}
+
+// WithRetry usa la política de reintentos p en lugar de la global.
+func WithRetry(p RetryPolicy) Option {
+    return func(cfg *config) {
+        cfg.retry = p
+    }
+}
+
+// WithPool toma las conexiones de p en lugar de abrir una por llamada.
+func WithPool(p *Pool) Option {
+    return func(cfg *config) {
+        cfg.pool = p
+    }
+}
+
+// WithSFTPTuning ajusta la concurrencia y el tamaño de paquete de SFTP. Con
+// un Pool el ajuste solo se aplica a los clientes que se abran de nuevo.
+func WithSFTPTuning(t SFTPTuning) Option {
+    return func(cfg *config) {
+        cfg.sftp = t
+    }
+}
@@ -0,0 +1,162 @@
+package ftp
+
+import (
+    "errors"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/pkg/sftp"
+)
+
+// Overwrite decide qué hacer al subir sobre un archivo remoto que ya existe.
+type Overwrite int
+
+const (
+    OverwriteAlways Overwrite = iota // lo reemplaza (por defecto)
+    OverwriteNever                   // falla con ErrWriteRefused
+    OverwriteNewer                   // solo si el local es más reciente o de otro tamaño
+    OverwriteBackup                  // lo renombra a nombre.bak antes de subir
+)
+
+var overwriteModes = map[string]Overwrite{
+    "always": OverwriteAlways,
+    "never":  OverwriteNever,
+    "newer":  OverwriteNewer,
+    "backup": OverwriteBackup,
+}
+
+// WithOverwrite indica qué hacer si el destino de una subida ya existe.
+// Equivale al parámetro ?overwrite=always|never|newer|backup. Con
+// OverwriteNewer los datos en memoria no tienen fecha y solo se compara el
+// tamaño. No afecta a AppendFTPFile ni a AppendFTPText.
+func WithOverwrite(mode Overwrite) Option {
+    return func(cfg *config) {
+        cfg.overwrite = mode
+    }
+}
+
+// overwriteMode devuelve el modo pedido con ?overwrite= o el de cfg.
+func overwriteMode(u *url.URL, cfg *config) Overwrite {
+    if mode, ok := overwriteModes[strings.ToLower(u.Query().Get("overwrite"))]; ok {
+        return mode
+    }
+    return cfg.overwrite
+}
+
+// remoteFile es lo que se sabe del destino antes de subir; size es -1 y
+// modTime cero si el servidor no los da.
+type remoteFile struct {
+    exists  bool
+    size    int64
+    modTime time.Time
+}
+
+// allowWrite decide según mode si se puede escribir sobre remote datos de
+// tamaño total y fecha local (cero si no se conoce).
+func allowWrite(mode Overwrite, remote remoteFile, total int64, local time.Time) error {
+    if !remote.exists {
+        return nil
+    }
+    switch mode {
+    case OverwriteNever:
+        return errorf(ErrWriteRefused, "el archivo remoto ya existe")
+    case OverwriteNewer:
+        if remote.size != total {
+            return nil
+        }
+        // MDTM y MLST solo tienen precisión de segundos
+        if !local.IsZero() && !remote.modTime.IsZero() && local.Truncate(time.Second).After(remote.modTime) {
+            return nil
+        }
+        return errorf(ErrWriteRefused, "el archivo remoto ya está al día")
+    }
+    return nil
+}
+
+// probe averigua si path existe con MLST o, si no lo hay, con SIZE y MDTM.
+func (s *ftpSession) probe(path string) (remoteFile, error) {
+    if _, ok := s.features["MLST"]; ok {
+        info, err := s.mlst(path)
+        switch {
+        case err == nil:
+            return remoteFile{exists: true, size: info.Size, modTime: info.ModTime}, nil
+        case ReplyCode(err) == 0:
+            return remoteFile{}, err
+        case ReplyCode(err) == 550:
+            return remoteFile{}, nil
+        }
+    }
+
+    // Algunos servidores rechazan SIZE en modo ASCII, así que un 550 solo
+    // se da por bueno si MDTM no dice lo contrario
+    remote := remoteFile{size: -1}
+    size, sizeErr := s.size(path)
+    modTime, mdtmErr := s.mdtm(path)
+    for _, err := range []error{sizeErr, mdtmErr} {
+        if err != nil && ReplyCode(err) == 0 {
+            return remoteFile{}, err
+        }
+    }
+    switch {
+    case sizeErr == nil || mdtmErr == nil:
+        remote.exists = true
+        if sizeErr == nil {
+            remote.size = size
+        }
+        if mdtmErr == nil {
+            remote.modTime = modTime
+        }
+        return remote, nil
+    case ReplyCode(sizeErr) == 550 || ReplyCode(mdtmErr) == 550:
+        return remote, nil
+    }
+    return remote, errorf(ErrWriteRefused, "no se puede comprobar si el archivo remoto existe")
+}
+
+// checkOverwrite aplica mode antes de subir a path por FTP.
+func (s *ftpSession) checkOverwrite(mode Overwrite, path string, total int64, local time.Time) error {
+    if mode == OverwriteAlways {
+        return nil
+    }
+    remote, err := s.probe(path)
+    if err != nil {
+        return err
+    }
+    if err := allowWrite(mode, remote, total, local); err != nil {
+        return err
+    }
+    if mode == OverwriteBackup && remote.exists {
+        // Se sustituye la copia anterior
+        s.dele(path + ".bak")
+        return s.rename(path, path+".bak")
+    }
+    return nil
+}
+
+// checkSFTPOverwrite aplica mode antes de subir a path por SFTP. El caso
+// OverwriteNever lo resuelve putSFTP creando el archivo con O_EXCL.
+func checkSFTPOverwrite(client *sftp.Client, mode Overwrite, path string, total int64, local time.Time) error {
+    if mode != OverwriteNewer && mode != OverwriteBackup {
+        return nil
+    }
+    stat, err := client.Stat(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return sftpError(err, "failed to stat file")
+    }
+    remote := remoteFile{exists: true, size: stat.Size(), modTime: stat.ModTime()}
+    if err := allowWrite(mode, remote, total, local); err != nil {
+        return err
+    }
+    if mode == OverwriteBackup {
+        client.Remove(path + ".bak")
+        if err := client.Rename(path, path+".bak"); err != nil {
+            return sftpError(err, "failed to rename existing file")
+        }
+    }
+    return nil
+}
@@ -0,0 +1,158 @@
+package ftp
+
+import (
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Parámetros admitidos en la query de las URLs. Los de conexión tienen
+// prioridad sobre el perfil:
+//
+//	profile   perfil de conexión (ver Profile)
+//	mode      passive o active (FTP)
+//	tls       none, explicit o implicit (FTP)
+//	insecure  1 para no validar el certificado TLS
+//	timeout   segundos (120) o duración (90s, 2m)
+//	key       clave privada SFTP
+//	hostkey   huella SHA256:... que debe tener la clave del servidor SFTP
+//	charset   utf-8, latin1 o cp1252, codificación de los nombres FTP
+//	verify    crc32, md5, sha1, sha256 o sha512, ver WithVerify
+//	sshexec   1 permite calcular hashes ejecutando md5sum, sha256sum... por
+//	          SSH
+//	type      binary o ascii, tipo de transferencia FTP
+//	mkdirs    1 crea los directorios que falten al subir (por defecto en
+//	          SFTP; 0 lo desactiva)
+//	overwrite always, never, newer o backup, ver WithOverwrite
+//	eol       lf, crlf o preserve, fin de línea del texto (ver TextOptions)
+//	trim      0 conserva los espacios de los extremos al leer texto
+//	bom       keep o add, marca de orden de bytes del texto
+//	encoding  utf-8, utf-16, utf-16le, utf-16be, latin1 o cp1252,
+//	          codificación del contenido del texto
+//	compress  gzip o zstd, ver WithCompression
+//	modez     1 pide MODE Z al servidor FTP, ver WithModeZ
+var urlParams = map[string]func(string) bool{
+    "profile":   func(v string) bool { return v != "" },
+    "mode":      oneOf("passive", "active"),
+    "tls":       oneOf("none", "explicit", "implicit"),
+    "insecure":  isBool,
+    "timeout":   func(v string) bool { d, ok := parseTimeout(v); return ok && d > 0 },
+    "key":       func(v string) bool { return v != "" },
+    "hostkey":   func(v string) bool { return strings.HasPrefix(v, "SHA256:") },
+    "type":      oneOf("binary", "ascii", "i", "a"),
+    "mkdirs":    isBool,
+    "charset":   func(v string) bool { _, ok := charsetName(v); return ok },
+    "verify":    func(v string) bool { _, ok := lookupHash(v); return ok },
+    "sshexec":   isBool,
+    "overwrite": func(v string) bool { _, ok := overwriteModes[strings.ToLower(v)]; return ok },
+    "eol":       oneOf("lf", "crlf", "preserve"),
+    "trim":      isBool,
+    "bom":       oneOf("keep", "add"),
+    "encoding":  func(v string) bool { _, ok := textCharset(v); return ok },
+    "compress":  func(v string) bool { _, ok := codecs[strings.ToLower(v)]; return ok },
+    "modez":     isBool,
+}
+
+func oneOf(values ...string) func(string) bool {
+    return func(v string) bool {
+        for _, value := range values {
+            if strings.EqualFold(v, value) {
+                return true
+            }
+        }
+        return false
+    }
+}
+
+func isBool(v string) bool {
+    _, err := strconv.ParseBool(v)
+    return err == nil
+}
+
+// parseTimeout acepta segundos enteros o una duración de Go.
+func parseTimeout(v string) (time.Duration, bool) {
+    if seconds, err := strconv.Atoi(v); err == nil {
+        return time.Duration(seconds) * time.Second, true
+    }
+    d, err := time.ParseDuration(v)
+    return d, err == nil
+}
+
+// checkParams rechaza parámetros desconocidos, repetidos o con valores no
+// válidos.
+func checkParams(u *url.URL) error {
+    query, err := url.ParseQuery(u.RawQuery)
+    if err != nil {
+        return wrapError(ErrInvalidOption, err, "parámetros de URL inválidos")
+    }
+    for key, values := range query {
+        valid, ok := urlParams[key]
+        if !ok {
+            return errorf(ErrInvalidOption, "parámetro de URL desconocido: %s", key)
+        }
+        if len(values) > 1 {
+            return errorf(ErrInvalidOption, "parámetro de URL repetido: %s", key)
+        }
+        if !valid(values[0]) {
+            return errorf(ErrInvalidOption, "valor inválido para %s: %s", key, values[0])
+        }
+    }
+    return nil
+}
+
+// applyParams aplica sobre settings los parámetros de conexión de u, ya
+// validados por checkParams.
+func applyParams(settings *connSettings, u *url.URL) {
+    query := u.Query()
+    if v := query.Get("mode"); v != "" {
+        settings.active = strings.EqualFold(v, "active")
+    }
+    if v := query.Get("tls"); v != "" {
+        settings.tls = strings.ToLower(v)
+        if settings.tls == "none" {
+            settings.tls = ""
+        }
+    }
+    if v := query.Get("insecure"); v != "" {
+        settings.insecure, _ = strconv.ParseBool(v)
+    }
+    if d, ok := parseTimeout(query.Get("timeout")); ok && d > 0 {
+        settings.timeout = d
+    }
+    if v := query.Get("key"); v != "" {
+        settings.keyFile = v
+    }
+    if v := query.Get("hostkey"); v != "" {
+        // Un "+" sin codificar llega como espacio
+        settings.hostKey = strings.ReplaceAll(v, " ", "+")
+    }
+    if v := query.Get("charset"); v != "" {
+        settings.charset, _ = charsetName(v)
+    }
+}
+
+// transferType devuelve el tipo FTP pedido con ?type= o def.
+func transferType(u *url.URL, def string) string {
+    switch strings.ToLower(u.Query().Get("type")) {
+    case "binary", "i":
+        return "I"
+    case "ascii", "a":
+        return "A"
+    }
+    return def
+}
+
+// sshExec indica si se pueden ejecutar comandos en el servidor SFTP.
+func sshExec(u *url.URL) bool {
+    v, _ := strconv.ParseBool(u.Query().Get("sshexec"))
+    return v
+}
+
+// makeDirs indica si hay que crear los directorios que falten al subir.
+func makeDirs(u *url.URL, def bool) bool {
+    if v, err := strconv.ParseBool(u.Query().Get("mkdirs")); err == nil {
+        return v
+    }
+    return def
+}
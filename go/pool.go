@@ -0,0 +1,413 @@
+package ftp
+
+import (
+    "context"
+    "net/url"
+    "sync"
+    "time"
+
+    "github.com/pkg/sftp"
+    "golang.org/x/crypto/ssh"
+)
+
+// Pool reutiliza sesiones FTP autenticadas y clientes SFTP entre llamadas y
+// goroutines. Las sesiones FTP se prestan en exclusiva; los clientes SFTP se
+// comparten porque admiten operaciones concurrentes.
+type Pool struct {
+    maxPerHost  int
+    idleTimeout time.Duration
+
+    mu     sync.Mutex
+    cond   *sync.Cond
+    hosts  map[poolKey]*poolHost
+    closed bool
+    done   chan struct{}
+}
+
+type poolKey struct {
+    scheme   string
+    host     string
+    user     string
+    pass     string
+    settings connSettings
+}
+
+type poolHost struct {
+    open    int // sesiones FTP abiertas, libres o prestadas
+    idle    []pooledFTP
+    sftp    []*pooledSFTP
+    dialing int // clientes SFTP que se están abriendo, ya contados en el límite
+}
+
+type pooledFTP struct {
+    s     *ftpSession
+    since time.Time
+}
+
+type pooledSFTP struct {
+    client *sftp.Client
+    conn   *ssh.Client
+    refs   int
+    since  time.Time
+    // dropped indica que ya no se presta; shut, que la conexión se cerró
+    dropped bool
+    shut    bool
+}
+
+// NewPool crea un pool con como mucho maxPerHost conexiones por servidor y
+// usuario (0 sin límite) que cierra las que lleven idleTimeout sin usarse
+// (0 las mantiene abiertas).
+func NewPool(maxPerHost int, idleTimeout time.Duration) *Pool {
+    p := &Pool{
+        maxPerHost:  maxPerHost,
+        idleTimeout: idleTimeout,
+        hosts:       make(map[poolKey]*poolHost),
+        done:        make(chan struct{}),
+    }
+    p.cond = sync.NewCond(&p.mu)
+    if idleTimeout > 0 {
+        go p.evictLoop()
+    }
+    return p
+}
+
+var (
+    poolMu     sync.RWMutex
+    poolGlobal *Pool
+)
+
+// SetPool hace que las llamadas sin WithPool usen p; nil vuelve a abrir una
+// conexión por llamada.
+func SetPool(p *Pool) {
+    poolMu.Lock()
+    poolGlobal = p
+    poolMu.Unlock()
+}
+
+func currentPool() *Pool {
+    poolMu.RLock()
+    defer poolMu.RUnlock()
+    return poolGlobal
+}
+
+func keyFor(u *url.URL) poolKey {
+    pass, _ := u.User.Password()
+    return poolKey{scheme: u.Scheme, host: u.Host, user: u.User.Username(), pass: pass, settings: settingsFor(u)}
+}
+
+func (p *Pool) host(key poolKey) *poolHost {
+    h := p.hosts[key]
+    if h == nil {
+        h = &poolHost{}
+        p.hosts[key] = h
+    }
+    return h
+}
+
+// getFTP presta una sesión libre que responda a NOOP o abre una nueva,
+// esperando si el servidor ya tiene maxPerHost sesiones abiertas.
+func (p *Pool) getFTP(ctx context.Context, u *url.URL) (*ftpSession, error) {
+    key := keyFor(u)
+    // Despertar la espera si se cancela ctx
+    stop := context.AfterFunc(ctx, func() {
+        p.mu.Lock()
+        p.cond.Broadcast()
+        p.mu.Unlock()
+    })
+    defer stop()
+
+    p.mu.Lock()
+    for {
+        if p.closed {
+            p.mu.Unlock()
+            return nil, errorf(ErrConnectionFailed, "pool cerrado")
+        }
+        if err := ctx.Err(); err != nil {
+            p.mu.Unlock()
+            return nil, wrapError(ErrCanceled, err, "operación cancelada")
+        }
+        h := p.host(key)
+        if n := len(h.idle); n > 0 {
+            s := h.idle[n-1].s
+            h.idle = h.idle[:n-1]
+            p.mu.Unlock()
+            s.ctx = ctx
+            if s.noop() == nil {
+                return s, nil
+            }
+            // Sesión rota: se descarta y se busca otra
+            s.close()
+            p.mu.Lock()
+            h.open--
+            p.cond.Broadcast()
+            continue
+        }
+        if p.maxPerHost <= 0 || h.open < p.maxPerHost {
+            h.open++
+            p.mu.Unlock()
+            s, err := dialFTP(ctx, u)
+            if err != nil {
+                p.mu.Lock()
+                h.open--
+                p.cond.Broadcast()
+                p.mu.Unlock()
+                return nil, err
+            }
+            return s, nil
+        }
+        p.cond.Wait()
+    }
+}
+
+// putFTP devuelve la sesión al pool; si la operación falló se cierra, ya que
+// la conexión puede haber quedado en un estado inconsistente.
+func (p *Pool) putFTP(u *url.URL, s *ftpSession, opErr error) {
+    key := keyFor(u)
+    p.mu.Lock()
+    h := p.host(key)
+    if opErr != nil || p.closed {
+        h.open--
+        p.cond.Broadcast()
+        p.mu.Unlock()
+        s.close()
+        return
+    }
+    h.idle = append(h.idle, pooledFTP{s: s, since: time.Now()})
+    p.cond.Broadcast()
+    p.mu.Unlock()
+}
+
+// getSFTP comparte el cliente menos cargado del servidor, o abre uno nuevo
+// si todos están en uso y no se alcanzó maxPerHost. Los clientes que se
+// están abriendo ocupan su hueco desde antes de conectar.
+func (p *Pool) getSFTP(ctx context.Context, u *url.URL, tuning SFTPTuning) (*pooledSFTP, error) {
+    key := keyFor(u)
+    // Despertar la espera si se cancela ctx
+    stop := context.AfterFunc(ctx, func() {
+        p.mu.Lock()
+        p.cond.Broadcast()
+        p.mu.Unlock()
+    })
+    defer stop()
+
+    p.mu.Lock()
+    for {
+        if p.closed {
+            p.mu.Unlock()
+            return nil, errorf(ErrSftpConnection, "pool cerrado")
+        }
+        if err := ctx.Err(); err != nil {
+            p.mu.Unlock()
+            return nil, wrapError(ErrCanceled, err, "operación cancelada")
+        }
+        h := p.host(key)
+        var best *pooledSFTP
+        for _, c := range h.sftp {
+            if best == nil || c.refs < best.refs {
+                best = c
+            }
+        }
+        full := p.maxPerHost > 0 && len(h.sftp)+h.dialing >= p.maxPerHost
+        if (best == nil || best.refs > 0) && !full {
+            h.dialing++
+            break
+        }
+        if best == nil {
+            // Todos los huecos se están abriendo: esperar a alguno
+            p.cond.Wait()
+            continue
+        }
+        best.refs++
+        check := best.refs == 1
+        p.mu.Unlock()
+        if !check {
+            return best, nil
+        }
+        if _, err := best.client.Getwd(); err == nil {
+            return best, nil
+        }
+        // Cliente roto: se descarta y se busca otro
+        p.mu.Lock()
+        best.refs--
+        p.dropSFTP(h, best)
+    }
+    p.mu.Unlock()
+
+    client, conn, err := createSFTPClient(ctx, u, tuning)
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    h := p.host(key)
+    h.dialing--
+    p.cond.Broadcast()
+    if err != nil {
+        return nil, err
+    }
+    if p.closed {
+        client.Close()
+        conn.Close()
+        return nil, errorf(ErrSftpConnection, "pool cerrado")
+    }
+    c := &pooledSFTP{client: client, conn: conn, refs: 1}
+    h.sftp = append(h.sftp, c)
+    return c, nil
+}
+
+// putSFTP libera el préstamo; si el fallo fue de conexión el cliente se cierra.
+func (p *Pool) putSFTP(u *url.URL, c *pooledSFTP, opErr error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    c.refs--
+    c.since = time.Now()
+    if c.dropped || p.closed || (opErr != nil && ErrorCode(opErr) == ErrSftpConnection) {
+        p.dropSFTP(p.host(keyFor(u)), c)
+    }
+}
+
+// dropSFTP quita c del pool y lo cierra cuando nadie lo esté usando.
+// Debe llamarse con p.mu tomado.
+func (p *Pool) dropSFTP(h *poolHost, c *pooledSFTP) {
+    for i, other := range h.sftp {
+        if other == c {
+            h.sftp = append(h.sftp[:i], h.sftp[i+1:]...)
+            break
+        }
+    }
+    c.dropped = true
+    if c.refs == 0 && !c.shut {
+        c.shut = true
+        go func() {
+            c.client.Close()
+            c.conn.Close()
+        }()
+    }
+}
+
+func (p *Pool) evictLoop() {
+    interval := p.idleTimeout / 2
+    if interval < 10*time.Millisecond {
+        interval = 10 * time.Millisecond
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-p.done:
+            return
+        case now := <-ticker.C:
+            p.evict(now)
+        }
+    }
+}
+
+// evict cierra las conexiones que llevan más de idleTimeout sin usarse.
+func (p *Pool) evict(now time.Time) {
+    var stale []*ftpSession
+    p.mu.Lock()
+    for _, h := range p.hosts {
+        kept := h.idle[:0]
+        for _, item := range h.idle {
+            if now.Sub(item.since) > p.idleTimeout {
+                stale = append(stale, item.s)
+                h.open--
+            } else {
+                kept = append(kept, item)
+            }
+        }
+        h.idle = kept
+        for _, c := range append([]*pooledSFTP(nil), h.sftp...) {
+            if c.refs == 0 && now.Sub(c.since) > p.idleTimeout {
+                p.dropSFTP(h, c)
+            }
+        }
+    }
+    p.cond.Broadcast()
+    p.mu.Unlock()
+
+    for _, s := range stale {
+        s.close()
+    }
+}
+
+// Close cierra las conexiones libres; las prestadas se cierran al devolverse.
+func (p *Pool) Close() {
+    p.mu.Lock()
+    if p.closed {
+        p.mu.Unlock()
+        return
+    }
+    p.closed = true
+    close(p.done)
+    var idle []*ftpSession
+    for _, h := range p.hosts {
+        for _, item := range h.idle {
+            idle = append(idle, item.s)
+            h.open--
+        }
+        h.idle = nil
+        for _, c := range append([]*pooledSFTP(nil), h.sftp...) {
+            p.dropSFTP(h, c)
+        }
+    }
+    p.cond.Broadcast()
+    p.mu.Unlock()
+
+    for _, s := range idle {
+        s.close()
+    }
+}
+
+// openFTP obtiene una sesión del pool configurado o abre una nueva; la
+// función devuelta la libera según el resultado de la operación. Si se
+// cancela el contexto la conexión se cierra y la sesión se descarta.
+func (cfg *config) openFTP(u *url.URL) (*ftpSession, func(error), error) {
+    if cfg.pool == nil {
+        s, err := dialFTP(cfg.ctx, u)
+        if err != nil {
+            return nil, nil, err
+        }
+        stop := context.AfterFunc(cfg.ctx, func() { s.conn.Close() })
+        return s, func(error) {
+            stop()
+            s.close()
+        }, nil
+    }
+    s, err := cfg.pool.getFTP(cfg.ctx, u)
+    if err != nil {
+        return nil, nil, err
+    }
+    stop := context.AfterFunc(cfg.ctx, func() { s.conn.Close() })
+    return s, func(opErr error) {
+        if !stop() && opErr == nil {
+            opErr = errorf(ErrCanceled, "operación cancelada")
+        }
+        cfg.pool.putFTP(u, s, opErr)
+    }, nil
+}
+
+// openSFTP es el equivalente de openFTP para clientes SFTP.
+func (cfg *config) openSFTP(u *url.URL) (*sftp.Client, func(error), error) {
+    client, _, release, err := cfg.openSSH(u)
+    return client, release, err
+}
+
+// openSSH es openSFTP devolviendo también la conexión SSH, para ejecutar
+// comandos en el servidor.
+func (cfg *config) openSSH(u *url.URL) (*sftp.Client, *ssh.Client, func(error), error) {
+    if cfg.pool == nil {
+        client, conn, err := createSFTPClient(cfg.ctx, u, cfg.sftp)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        stop := context.AfterFunc(cfg.ctx, func() { conn.Close() })
+        return client, conn, func(error) {
+            stop()
+            client.Close()
+            conn.Close()
+        }, nil
+    }
+    c, err := cfg.pool.getSFTP(cfg.ctx, u, cfg.sftp)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    return c.client, c.conn, func(opErr error) { cfg.pool.putSFTP(u, c, opErr) }, nil
+}
@@ -0,0 +1,102 @@
+package ftp
+
+import (
+    "bytes"
+    "context"
+    "net"
+    "net/url"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+// countListener cuenta las conexiones que acepta el servidor y cierra nada
+// más aceptarlas las primeras drop.
+type countListener struct {
+    net.Listener
+    n    atomic.Int32
+    drop int32
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+    for {
+        conn, err := l.Listener.Accept()
+        if err != nil {
+            return nil, err
+        }
+        if l.n.Add(1) > l.drop {
+            return conn, nil
+        }
+        conn.Close()
+    }
+}
+
+// countedSFTP sirve mem por SFTP a través de un countListener.
+func countedSFTP(t *testing.T, mem *server.MemFS, drop int32) (*countListener, string) {
+    t.Helper()
+    srv := server.NewSFTP(mem, map[string]string{"u": "p"})
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    counted := &countListener{Listener: l, drop: drop}
+    go srv.Serve(counted)
+    t.Cleanup(func() { srv.Close() })
+    u := url.URL{Scheme: "sftp", User: url.UserPassword("u", "p"), Host: l.Addr().String(), Path: "/a.bin"}
+    return counted, u.String()
+}
+
+func TestPoolSFTPLimit(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", bytes.Repeat([]byte("x"), 64<<10))
+    counted, sftpUrl := countedSFTP(t, mem, 0)
+
+    const limit = 2
+    pool := NewPool(limit, time.Minute)
+    defer pool.Close()
+
+    // Todas las llamadas empiezan a la vez, sin clientes abiertos todavía
+    var wg sync.WaitGroup
+    start := make(chan struct{})
+    errs := make(chan error, 16)
+    for i := 0; i < 16; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            <-start
+            if _, err := GetFTPBytes(sftpUrl, WithPool(pool)); err != nil {
+                errs <- err
+            }
+        }()
+    }
+    close(start)
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Error(err)
+    }
+    if n := counted.n.Load(); n < 1 || n > limit {
+        t.Fatalf("%d conexiones SSH con un límite de %d", n, limit)
+    }
+}
+
+func TestPoolSFTPDialFailure(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", []byte("contenido"))
+    _, sftpUrl := countedSFTP(t, mem, 1)
+    pool := NewPool(1, time.Minute)
+    defer pool.Close()
+
+    if _, err := GetFTPBytes(sftpUrl, WithPool(pool)); ErrorCode(err) != ErrSftpConnection {
+        t.Fatalf("conexión cortada: %v", err)
+    }
+    // La conexión fallida no debe quedarse con el único hueco
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if _, err := GetFTPBytes(sftpUrl, WithPool(pool), WithContext(ctx)); err != nil {
+        t.Fatal(err)
+    }
+}
@@ -0,0 +1,272 @@
+package ftp
+
+import (
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/BurntSushi/toml"
+    "gopkg.in/yaml.v3"
+)
+
+// Profile agrupa los datos de conexión de un servidor. Una URL lo usa si su
+// host es el nombre del perfil (ftp://@socio/entrada) o con ?profile=nombre,
+// en cuyo caso el host del perfil solo se aplica si la URL no trae otro
+// (ftp:///entrada?profile=socio). El puerto y las credenciales de la URL
+// tienen prioridad.
+type Profile struct {
+    Host     string
+    Port     int
+    User     string
+    Password string
+
+    // TLS es "" (sin cifrar), "explicit" (AUTH TLS) o "implicit" (puerto
+    // 990); InsecureSkipVerify no valida el certificado del servidor.
+    TLS                string
+    InsecureSkipVerify bool
+    // Active usa PORT/EPRT en lugar de PASV.
+    Active bool
+    // KeyFile es la clave privada para SFTP y KeyPassphrase su contraseña.
+    KeyFile       string
+    KeyPassphrase string
+    // HostKey es la huella SHA256:... que debe tener la clave del servidor
+    // SFTP; vacío acepta cualquiera.
+    HostKey string
+    // Charset es la codificación de los nombres en servidores FTP que no
+    // usan UTF-8: "latin1" o "cp1252".
+    Charset string
+    // Timeout limita la conexión y cada espera de datos; 0 usa 30s.
+    Timeout time.Duration
+}
+
+// profileFile es un perfil tal como se escribe en el archivo.
+type profileFile struct {
+    Host               string `json:"host" yaml:"host" toml:"host"`
+    Port               int    `json:"port" yaml:"port" toml:"port"`
+    User               string `json:"user" yaml:"user" toml:"user"`
+    Password           string `json:"password" yaml:"password" toml:"password"`
+    TLS                string `json:"tls" yaml:"tls" toml:"tls"`
+    InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+    Mode               string `json:"mode" yaml:"mode" toml:"mode"`
+    KeyFile            string `json:"key_file" yaml:"key_file" toml:"key_file"`
+    KeyPassphrase      string `json:"key_passphrase" yaml:"key_passphrase" toml:"key_passphrase"`
+    HostKey            string `json:"host_key" yaml:"host_key" toml:"host_key"`
+    Charset            string `json:"charset" yaml:"charset" toml:"charset"`
+    Timeout            string `json:"timeout" yaml:"timeout" toml:"timeout"`
+}
+
+var (
+    profileMu sync.RWMutex
+    profiles  = map[string]Profile{}
+)
+
+// LoadFTPProfiles sustituye los perfiles por los de path, un archivo YAML,
+// JSON o TOML (según su extensión) con un perfil por nombre:
+//
+//	socio-acme:
+//	  host: ftp.acme.com
+//	  port: 2121
+//	  user: entrada
+//	  tls: explicit
+//	  mode: active
+//	  timeout: 10s
+func LoadFTPProfiles(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return wrapError(ErrInvalidOption, err, "error leyendo perfiles")
+    }
+
+    var raw map[string]profileFile
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, &raw)
+    case ".json":
+        err = json.Unmarshal(data, &raw)
+    case ".toml":
+        err = toml.Unmarshal(data, &raw)
+    default:
+        return errorf(ErrInvalidOption, "formato de perfiles desconocido: %s", path)
+    }
+    if err != nil {
+        return wrapError(ErrInvalidOption, err, "error analizando perfiles")
+    }
+
+    loaded := make(map[string]Profile, len(raw))
+    for name, r := range raw {
+        p := Profile{
+            Host:               r.Host,
+            Port:               r.Port,
+            User:               r.User,
+            Password:           r.Password,
+            TLS:                r.TLS,
+            InsecureSkipVerify: r.InsecureSkipVerify,
+            KeyFile:            r.KeyFile,
+            KeyPassphrase:      r.KeyPassphrase,
+            HostKey:            r.HostKey,
+            Charset:            r.Charset,
+        }
+        switch strings.ToLower(r.Mode) {
+        case "", "passive":
+        case "active":
+            p.Active = true
+        default:
+            return errorf(ErrInvalidOption, "perfil %s: modo inválido: %s", name, r.Mode)
+        }
+        if r.Timeout != "" {
+            if p.Timeout, err = time.ParseDuration(r.Timeout); err != nil {
+                return wrapError(ErrInvalidOption, err, "perfil "+name+": timeout inválido")
+            }
+        }
+        if err := p.validate(); err != nil {
+            return errorf(ErrInvalidOption, "perfil %s: %v", name, err)
+        }
+        loaded[name] = p
+    }
+
+    profileMu.Lock()
+    profiles = loaded
+    profileMu.Unlock()
+    return nil
+}
+
+// SetFTPProfile añade o reemplaza el perfil name.
+func SetFTPProfile(name string, p Profile) error {
+    if name == "" {
+        return errorf(ErrInvalidOption, "falta el nombre del perfil")
+    }
+    if err := p.validate(); err != nil {
+        return errorf(ErrInvalidOption, "perfil %s: %v", name, err)
+    }
+    profileMu.Lock()
+    profiles[name] = p
+    profileMu.Unlock()
+    return nil
+}
+
+func (p Profile) validate() error {
+    switch p.TLS {
+    case "", "explicit", "implicit":
+    default:
+        return fmt.Errorf("tls inválido: %s", p.TLS)
+    }
+    if p.HostKey != "" && !strings.HasPrefix(p.HostKey, "SHA256:") {
+        return fmt.Errorf("host_key debe empezar por SHA256:")
+    }
+    if _, ok := charsetName(p.Charset); !ok {
+        return fmt.Errorf("charset inválido: %s", p.Charset)
+    }
+    if p.Port < 0 || p.Port > 65535 || p.Timeout < 0 {
+        return fmt.Errorf("puerto o timeout inválido")
+    }
+    return nil
+}
+
+func lookupProfile(name string) (Profile, bool) {
+    profileMu.RLock()
+    defer profileMu.RUnlock()
+    p, ok := profiles[name]
+    return p, ok
+}
+
+// applyProfile sustituye en u el host y las credenciales del perfil que le
+// corresponda y deja su nombre en ?profile= para los ajustes de conexión. La
+// contraseña del perfil solo se envía a su host (Host o, si está vacío, el
+// nombre del perfil); una URL que lleve el perfil a otro host se rechaza.
+func applyProfile(u *url.URL) error {
+    query := u.Query()
+    name := query.Get("profile")
+    explicit := name != ""
+    if !explicit {
+        name = u.Hostname()
+    }
+    p, ok := lookupProfile(name)
+    if !ok {
+        if explicit {
+            return errorf(ErrInvalidOption, "perfil desconocido: %s", name)
+        }
+        return nil
+    }
+
+    host, port := u.Hostname(), u.Port()
+    if p.Host != "" && (host == "" || host == name) {
+        host = p.Host
+    }
+    if port == "" && p.Port > 0 {
+        port = strconv.Itoa(p.Port)
+    }
+    u.Host = host
+    if port != "" {
+        u.Host = net.JoinHostPort(host, port)
+    }
+
+    profileHost := p.Host
+    if profileHost == "" {
+        profileHost = name
+    }
+    _, hasPass := u.User.Password()
+    if !hasPass && p.Password != "" && !strings.EqualFold(host, profileHost) {
+        return errorf(ErrInvalidOption, "el perfil %s es para %s, no para %s", name, profileHost, host)
+    }
+
+    if !hasPass {
+        user := u.User.Username()
+        if user == "" {
+            user = p.User
+        }
+        switch {
+        case p.Password != "" && (p.User == "" || user == p.User):
+            u.User = url.UserPassword(user, p.Password)
+        case user != "":
+            u.User = url.User(user)
+        }
+    }
+
+    if !explicit {
+        query.Set("profile", name)
+        u.RawQuery = query.Encode()
+    }
+    return nil
+}
+
+// connSettings son los ajustes de conexión que no caben en la URL.
+type connSettings struct {
+    timeout    time.Duration
+    tls        string
+    insecure   bool
+    active     bool
+    keyFile    string
+    passphrase string
+    hostKey    string
+    charset    string
+}
+
+// settingsFor devuelve los ajustes del perfil de u, o los valores por
+// defecto, con los parámetros de la URL por encima.
+func settingsFor(u *url.URL) connSettings {
+    settings := connSettings{timeout: timeout}
+    if p, ok := lookupProfile(u.Query().Get("profile")); ok {
+        settings.apply(p)
+    }
+    applyParams(&settings, u)
+    return settings
+}
+
+func (settings *connSettings) apply(p Profile) {
+    if p.Timeout > 0 {
+        settings.timeout = p.Timeout
+    }
+    settings.tls = p.TLS
+    settings.insecure = p.InsecureSkipVerify
+    settings.active = p.Active
+    settings.keyFile = p.KeyFile
+    settings.passphrase = p.KeyPassphrase
+    settings.hostKey = p.HostKey
+    settings.charset, _ = charsetName(p.Charset)
+}
@@ -0,0 +1,74 @@
+package ftp
+
+import (
+    "io"
+)
+
+// WithProgress llama a fn durante las descargas y subidas con los bytes ya
+// transferidos y el total (-1 si el servidor no lo informa). Tras un
+// reintento done puede retroceder.
+func WithProgress(fn func(done, total int64)) Option {
+    return func(cfg *config) {
+        cfg.progress = fn
+    }
+}
+
+// progressSink informa del avance de una descarga.
+type progressSink struct {
+    sink
+    fn    func(done, total int64)
+    total int64
+}
+
+func (p *progressSink) Write(b []byte) (int, error) {
+    n, err := p.sink.Write(b)
+    p.fn(p.sink.offset(), p.total)
+    return n, err
+}
+
+// trackSink envuelve dst si hay WithProgress; setTotal fija el total cuando
+// se conoce.
+func (cfg *config) trackSink(dst sink) (sink, func(total int64)) {
+    if cfg.progress == nil {
+        return dst, func(int64) {}
+    }
+    p := &progressSink{sink: dst, fn: cfg.progress, total: -1}
+    return p, func(total int64) { p.total = total }
+}
+
+// progressReader informa del avance de una subida.
+type progressReader struct {
+    io.ReadSeeker
+    fn    func(done, total int64)
+    total int64
+    pos   int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+    n, err := p.ReadSeeker.Read(b)
+    p.pos += int64(n)
+    p.fn(p.pos, p.total)
+    return n, err
+}
+
+// Size da lo que queda por leer, para que File.ReadFrom de SFTP pueda
+// calcular su concurrencia.
+func (p *progressReader) Size() int64 {
+    return p.total - p.pos
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+    pos, err := p.ReadSeeker.Seek(offset, whence)
+    if err == nil {
+        p.pos = pos
+    }
+    return pos, err
+}
+
+// trackReader envuelve src, de tamaño total, si hay WithProgress.
+func (cfg *config) trackReader(src io.ReadSeeker, total int64) io.ReadSeeker {
+    if cfg.progress == nil {
+        return src
+    }
+    return &progressReader{ReadSeeker: src, fn: cfg.progress, total: total}
+}
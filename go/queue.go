@@ -0,0 +1,285 @@
+package ftp
+
+import (
+    "errors"
+    "io"
+    "net/url"
+    "os"
+    "sync"
+    "time"
+)
+
+// Transfer copia Source en Destination. Cada extremo puede ser una URL
+// ftp://, sftp:// o una ruta local.
+type Transfer struct {
+    Source      string `json:"source"`
+    Destination string `json:"destination"`
+}
+
+// Estados de una transferencia dentro de una TransferQueue.
+const (
+    TransferPending = "pending"
+    TransferRunning = "running"
+    TransferDone    = "done"
+    TransferFailed  = "failed"
+)
+
+// TransferResult es el estado de una transferencia de la cola.
+type TransferResult struct {
+    Transfer
+    Status   string    `json:"status"`
+    Bytes    int64     `json:"bytes"`
+    Code     int       `json:"code,omitempty"`
+    Error    string    `json:"error,omitempty"`
+    Started  time.Time `json:"started,omitzero"`
+    Finished time.Time `json:"finished,omitzero"`
+}
+
+// BatchReport resume el estado de todas las transferencias de la cola.
+type BatchReport struct {
+    Total    int              `json:"total"`
+    Pending  int              `json:"pending"`
+    Running  int              `json:"running"`
+    Done     int              `json:"done"`
+    Failed   int              `json:"failed"`
+    Finished bool             `json:"finished"`
+    Bytes    int64            `json:"bytes"`
+    Items    []TransferResult `json:"items"`
+}
+
+// TransferQueue ejecuta transferencias con concurrencia limitada. Todas
+// comparten un Pool de conexiones, el de WithPool o uno propio que se cierra
+// con Close.
+type TransferQueue struct {
+    opts    []Option
+    ownPool *Pool
+    sem     chan struct{}
+    wg      sync.WaitGroup
+
+    mu    sync.Mutex
+    items []TransferResult
+}
+
+// NewTransferQueue crea una cola que ejecuta como mucho concurrency
+// transferencias a la vez (1 si es menor).
+func NewTransferQueue(concurrency int, opts ...Option) *TransferQueue {
+    if concurrency < 1 {
+        concurrency = 1
+    }
+    q := &TransferQueue{
+        sem:  make(chan struct{}, concurrency),
+        opts: opts,
+    }
+    if newConfig(opts).pool == nil {
+        q.ownPool = NewPool(concurrency, 30*time.Second)
+        q.opts = append(append([]Option(nil), opts...), WithPool(q.ownPool))
+    }
+    return q
+}
+
+// Add encola t, que empieza en cuanto haya un hueco libre, y devuelve su
+// índice en el informe.
+func (q *TransferQueue) Add(t Transfer) int {
+    q.mu.Lock()
+    index := len(q.items)
+    q.items = append(q.items, TransferResult{Transfer: t, Status: TransferPending})
+    q.mu.Unlock()
+
+    q.wg.Add(1)
+    go func() {
+        defer q.wg.Done()
+        q.sem <- struct{}{}
+        defer func() { <-q.sem }()
+
+        q.update(index, func(r *TransferResult) {
+            r.Status = TransferRunning
+            r.Started = time.Now()
+        })
+        n, err := q.run(t)
+        q.update(index, func(r *TransferResult) {
+            r.Finished = time.Now()
+            r.Bytes = n
+            if err != nil {
+                r.Status = TransferFailed
+                r.Code = ErrorCode(err)
+                r.Error = err.Error()
+            } else {
+                r.Status = TransferDone
+            }
+        })
+    }()
+    return index
+}
+
+func (q *TransferQueue) update(index int, fn func(*TransferResult)) {
+    q.mu.Lock()
+    fn(&q.items[index])
+    q.mu.Unlock()
+}
+
+// Report devuelve el estado actual de la cola.
+func (q *TransferQueue) Report() BatchReport {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    report := BatchReport{Total: len(q.items), Items: append([]TransferResult(nil), q.items...)}
+    for _, item := range q.items {
+        switch item.Status {
+        case TransferPending:
+            report.Pending++
+        case TransferRunning:
+            report.Running++
+        case TransferDone:
+            report.Done++
+        case TransferFailed:
+            report.Failed++
+        }
+        report.Bytes += item.Bytes
+    }
+    report.Finished = report.Pending == 0 && report.Running == 0
+    return report
+}
+
+// Wait espera a que terminen todas las transferencias encoladas.
+func (q *TransferQueue) Wait() BatchReport {
+    q.wg.Wait()
+    return q.Report()
+}
+
+// Close espera a la cola y cierra su Pool propio.
+func (q *TransferQueue) Close() {
+    q.wg.Wait()
+    if q.ownPool != nil {
+        q.ownPool.Close()
+    }
+}
+
+func isRemote(path string) bool {
+    u, err := url.Parse(path)
+    return err == nil && (u.Scheme == "ftp" || u.Scheme == "sftp")
+}
+
+// run copia t por el camino que corresponda a sus extremos y devuelve los
+// bytes transferidos.
+func (q *TransferQueue) run(t Transfer) (int64, error) {
+    if t.Source == "" || t.Destination == "" {
+        return 0, errorf(ErrEmptyURL, "falta origen o destino")
+    }
+
+    srcRemote, dstRemote := isRemote(t.Source), isRemote(t.Destination)
+    switch {
+    case srcRemote && !dstRemote:
+        if err := DownloadFTPFile(t.Source, t.Destination, q.opts...); err != nil {
+            return 0, err
+        }
+        return localSize(t.Destination), nil
+
+    case !srcRemote && dstRemote:
+        if err := UploadFTPFile(t.Source, t.Destination, q.opts...); err != nil {
+            return 0, err
+        }
+        return localSize(t.Source), nil
+
+    case srcRemote && dstRemote:
+        return q.copyRemote(t.Source, t.Destination)
+
+    default:
+        return copyLocal(t.Source, t.Destination)
+    }
+}
+
+// copyRemote pasa el origen al destino por una tubería, sin cargar el
+// archivo en memoria ni aplicar el límite de 90MB. Como ningún extremo puede
+// volver a leerse, la verificación compara los hashes de ambos servidores.
+func (q *TransferQueue) copyRemote(source, destination string) (int64, error) {
+    getCfg, putCfg := newConfig(q.opts), newConfig(q.opts)
+    // La descarga abre su propia conexión: si esperase un hueco del pool
+    // mientras la subida ocupa el último, ninguna de las dos avanzaría
+    getCfg.pool = nil
+    algo := getCfg.verify
+    getCfg.verify, putCfg.verify = "", ""
+    source, srcAlgo := withoutVerify(source)
+    destination, dstAlgo := withoutVerify(destination)
+    if dstAlgo != "" {
+        algo = dstAlgo
+    } else if srcAlgo != "" {
+        algo = srcAlgo
+    }
+
+    pr, pw := io.Pipe()
+    done := make(chan error, 1)
+    go func() {
+        err := getStream(source, &writerSink{w: pw}, getCfg)
+        pw.CloseWithError(err)
+        done <- err
+    }()
+    src := &streamSource{r: pr}
+    err := putStream(destination, src, putCfg)
+    // Si la subida falla la descarga deja de escribir en la tubería y
+    // termina con ese mismo error; si no, el fallo de la descarga es la causa
+    pr.CloseWithError(err)
+    if getErr := <-done; getErr != nil && (err == nil || !errors.Is(getErr, err)) {
+        return src.pos, getErr
+    }
+    if err != nil || algo == "" {
+        return src.pos, err
+    }
+
+    srcSum, err := ChecksumFTP(source, algo, q.opts...)
+    if err != nil {
+        return src.pos, err
+    }
+    dstSum, err := ChecksumFTP(destination, algo, q.opts...)
+    if err != nil {
+        return src.pos, err
+    }
+    if srcSum != dstSum {
+        return src.pos, errorf(ErrChecksumMismatch, "%s distinto: origen %s, destino %s", algo, srcSum, dstSum)
+    }
+    return src.pos, nil
+}
+
+// withoutVerify quita ?verify de rawURL y devuelve el algoritmo pedido.
+func withoutVerify(rawURL string) (string, string) {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL, ""
+    }
+    query := u.Query()
+    algo := query.Get("verify")
+    if algo == "" {
+        return rawURL, ""
+    }
+    query.Del("verify")
+    u.RawQuery = query.Encode()
+    return u.String(), algo
+}
+
+func localSize(path string) int64 {
+    stat, err := os.Stat(path)
+    if err != nil {
+        return 0
+    }
+    return stat.Size()
+}
+
+func copyLocal(src, dst string) (int64, error) {
+    in, err := os.Open(src)
+    if err != nil {
+        return 0, wrapError(ErrEmptyData, err, "error abriendo archivo local")
+    }
+    defer in.Close()
+
+    out, err := os.Create(dst)
+    if err != nil {
+        return 0, wrapError(ErrDataTransfer, err, "error creando archivo local")
+    }
+    n, err := io.Copy(out, in)
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return n, wrapError(ErrDataTransfer, err, "error copiando archivo local")
+    }
+    return n, nil
+}
@@ -0,0 +1,149 @@
+package ftp
+
+import (
+    "bytes"
+    "crypto/rand"
+    "fmt"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+func TestTransferQueueRemoteCopy(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    src, dst := server.NewMemFS(), server.NewMemFS()
+    ftpSrv, err := server.Start(src, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ftpSrv.Close()
+    sftpSrv, err := server.StartSFTP(dst, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer sftpSrv.Close()
+    ftpDst, err := server.Start(dst, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer ftpDst.Close()
+
+    files := make(map[string][]byte)
+    q := NewTransferQueue(4, WithRetry(RetryPolicy{MaxAttempts: 1}))
+    defer q.Close()
+    for i := 0; i < 8; i++ {
+        data := make([]byte, (i+1)<<20)
+        rand.Read(data)
+        name := fmt.Sprintf("/f%d.bin", i)
+        files[name] = data
+        src.WriteFile(name, data)
+        // Alterna FTP→SFTP y FTP→FTP
+        destination := sftpSrv.URL("u", "p", name)
+        if i%2 == 1 {
+            destination = ftpDst.URL("u", "p", name)
+        }
+        q.Add(Transfer{Source: ftpSrv.URL("u", "p", name), Destination: destination})
+    }
+    // SFTP→FTP de vuelta al origen
+    q.Add(Transfer{Source: sftpSrv.URL("u", "p", "/vuelta.bin"), Destination: ftpSrv.URL("u", "p", "/vuelta.bin")})
+    files["/vuelta.bin"] = bytes.Repeat([]byte("vuelta\n"), 1000)
+    dst.WriteFile("/vuelta.bin", files["/vuelta.bin"])
+
+    report := q.Wait()
+    if report.Failed != 0 || report.Done != len(files) {
+        t.Fatalf("informe: %+v", report)
+    }
+    for _, item := range report.Items {
+        if name := item.Source[len(item.Source)-len("/f0.bin"):]; item.Bytes != int64(len(files[name])) && item.Bytes != int64(len(files["/vuelta.bin"])) {
+            t.Errorf("%s: %d bytes en el informe", item.Source, item.Bytes)
+        }
+    }
+    for name, data := range files {
+        fsys := dst
+        if name == "/vuelta.bin" {
+            fsys = src
+        }
+        got, err := fsys.ReadFile(name)
+        if err != nil || !bytes.Equal(got, data) {
+            t.Errorf("%s: copia distinta (%d de %d bytes): %v", name, len(got), len(data), err)
+        }
+    }
+}
+
+func TestTransferQueueRemoteCopyErrors(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", bytes.Repeat([]byte("a"), 256<<10))
+    srv, err := server.Start(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    q := NewTransferQueue(2)
+    defer q.Close()
+    // El origen no existe: la subida no debe quedarse esperando datos
+    missing := q.Add(Transfer{Source: srv.URL("u", "p", "/no-existe.bin"), Destination: srv.URL("u", "p", "/b.bin")})
+    // El destino no se puede crear: la descarga no debe quedarse escribiendo
+    refused := q.Add(Transfer{Source: srv.URL("u", "p", "/a.bin"), Destination: srv.URL("u", "p", "/no/existe/b.bin")})
+    report := q.Wait()
+
+    for _, index := range []int{missing, refused} {
+        if item := report.Items[index]; item.Status != TransferFailed || ReplyCode(&Error{}) != 0 || item.Code == 0 {
+            t.Errorf("%s → %s: %+v", item.Source, item.Destination, item)
+        }
+    }
+}
+
+func TestTransferQueueVerify(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", bytes.Repeat([]byte("verificar"), 10000))
+    srv, err := server.Start(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    q := NewTransferQueue(1, WithVerify("sha256"))
+    defer q.Close()
+    q.Add(Transfer{Source: srv.URL("u", "p", "/a.bin"), Destination: srv.URL("u", "p", "/b.bin")})
+    q.Add(Transfer{Source: srv.URL("u", "p", "/a.bin"), Destination: srv.URL("u", "p", "/c.bin") + "?verify=md5"})
+    unknown := q.Add(Transfer{Source: srv.URL("u", "p", "/a.bin"), Destination: srv.URL("u", "p", "/d.bin") + "?verify=md4"})
+    report := q.Wait()
+    if report.Failed != 1 || report.Items[unknown].Code != ErrInvalidOption {
+        t.Fatalf("informe: %+v", report)
+    }
+}
+
+func TestTransferQueueLocal(t *testing.T) {
+    users := map[string]string{"u": "p"}
+    mem := server.NewMemFS()
+    srv, err := server.Start(mem, users)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    dir := t.TempDir()
+    local := filepath.Join(dir, "origen.txt")
+    os.WriteFile(local, []byte("local\n"), 0644)
+
+    q := NewTransferQueue(1)
+    defer q.Close()
+    q.Add(Transfer{Source: local, Destination: srv.URL("u", "p", "/subido.txt")})
+    q.Wait()
+    q.Add(Transfer{Source: srv.URL("u", "p", "/subido.txt"), Destination: filepath.Join(dir, "bajado.txt")})
+    q.Add(Transfer{Source: local, Destination: filepath.Join(dir, "copia.txt")})
+    report := q.Wait()
+    if report.Failed != 0 || report.Bytes != 18 {
+        t.Fatalf("informe: %+v", report)
+    }
+    for _, name := range []string{"bajado.txt", "copia.txt"} {
+        if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != "local\n" {
+            t.Errorf("%s: %q", name, got)
+        }
+    }
+}
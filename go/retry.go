@@ -0,0 +1,133 @@
+package ftp
+
+import (
+    "context"
+    "math/rand"
+    "sync"
+    "time"
+)
+
+// RetryPolicy define cuántas veces y con qué espera se repite una operación
+// que falló por un error transitorio. Las descargas binarias y las subidas
+// se reanudan desde lo ya transferido cuando el servidor lo permite.
+type RetryPolicy struct {
+    MaxAttempts    int           // intentos totales; 0 o 1 desactiva los reintentos
+    InitialBackoff time.Duration // espera antes del segundo intento
+    MaxBackoff     time.Duration // tope de la espera; 0 sin tope
+    Multiplier     float64       // crecimiento de la espera entre intentos; 2 si es 0
+    Jitter         float64       // fracción aleatoria (0..1) aplicada a cada espera
+
+    // RetryableErrors son los códigos Err* que se reintentan cuando el fallo
+    // no vino de una respuesta del servidor.
+    RetryableErrors []int
+    // RetryableReplies son las respuestas FTP que se reintentan; un valor de
+    // 1 a 5 representa toda la clase (4 equivale a 4xx).
+    RetryableReplies []int
+}
+
+// DefaultRetryPolicy devuelve una política razonable para enlaces inestables:
+// tres intentos ante fallos de conexión, cortes de la conexión de datos o de
+// control durante una transferencia (ErrDataTransfer y ErrTransferConfirm
+// sin respuesta del servidor) y respuestas 421, 425, 426 y 450.
+func DefaultRetryPolicy() RetryPolicy {
+    return RetryPolicy{
+        MaxAttempts:      3,
+        InitialBackoff:   500 * time.Millisecond,
+        MaxBackoff:       30 * time.Second,
+        Multiplier:       2,
+        Jitter:           0.2,
+        RetryableErrors:  []int{ErrConnectionFailed, ErrInitialRead, ErrSftpConnection, ErrDataTransfer, ErrTransferConfirm},
+        RetryableReplies: []int{421, 425, 426, 450},
+    }
+}
+
+var (
+    retryMu     sync.RWMutex
+    retryGlobal = RetryPolicy{MaxAttempts: 1}
+)
+
+// SetRetryPolicy cambia la política usada por las llamadas sin WithRetry.
+// Por defecto no se reintenta.
+func SetRetryPolicy(p RetryPolicy) {
+    retryMu.Lock()
+    retryGlobal = p
+    retryMu.Unlock()
+}
+
+func currentRetryPolicy() RetryPolicy {
+    retryMu.RLock()
+    defer retryMu.RUnlock()
+    return retryGlobal
+}
+
+// Retryable indica si err debe reintentarse según la política.
+func (p RetryPolicy) Retryable(err error) bool {
+    if err == nil {
+        return false
+    }
+    if reply := ReplyCode(err); reply != 0 {
+        for _, r := range p.RetryableReplies {
+            if r == reply || (r >= 1 && r <= 5 && reply/100 == r) {
+                return true
+            }
+        }
+        return false
+    }
+    code := ErrorCode(err)
+    for _, c := range p.RetryableErrors {
+        if c == code {
+            return true
+        }
+    }
+    return false
+}
+
+// backoff calcula la espera tras el intento número attempt (desde 1).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+    multiplier := p.Multiplier
+    if multiplier <= 0 {
+        multiplier = 2
+    }
+    wait := float64(p.InitialBackoff)
+    for i := 1; i < attempt; i++ {
+        wait *= multiplier
+        if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+            break
+        }
+    }
+    if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+        wait = float64(p.MaxBackoff)
+    }
+    if p.Jitter > 0 {
+        wait += wait * p.Jitter * (2*rand.Float64() - 1)
+    }
+    if wait < 0 {
+        return 0
+    }
+    return time.Duration(wait)
+}
+
+// do ejecuta op hasta que tenga éxito, falle con un error no reintentable,
+// se agoten los intentos o se cancele ctx.
+func (p RetryPolicy) do(ctx context.Context, op func() error) error {
+    for attempt := 1; ; attempt++ {
+        if err := ctx.Err(); err != nil {
+            return wrapError(ErrCanceled, err, "operación cancelada")
+        }
+        err := op()
+        if err != nil && ctx.Err() != nil {
+            return wrapError(ErrCanceled, ctx.Err(), "operación cancelada")
+        }
+        if err == nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+            return err
+        }
+
+        timer := time.NewTimer(p.backoff(attempt))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return wrapError(ErrCanceled, ctx.Err(), "operación cancelada")
+        case <-timer.C:
+        }
+    }
+}
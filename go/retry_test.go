@@ -0,0 +1,276 @@
+package ftp
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "io"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+    p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+    want := []time.Duration{
+        100 * time.Millisecond,
+        200 * time.Millisecond,
+        400 * time.Millisecond,
+        800 * time.Millisecond,
+        time.Second,
+        time.Second,
+    }
+    for i, w := range want {
+        if got := p.backoff(i + 1); got != w {
+            t.Errorf("intento %d: espera %v, se esperaba %v", i+1, got, w)
+        }
+    }
+
+    p.Multiplier = 3
+    if got := p.backoff(3); got != 900*time.Millisecond {
+        t.Errorf("multiplicador 3: espera %v", got)
+    }
+
+    // Sin tope la espera sigue creciendo
+    p = RetryPolicy{InitialBackoff: time.Second}
+    if got := p.backoff(11); got != 1024*time.Second {
+        t.Errorf("sin tope: espera %v", got)
+    }
+
+    p = RetryPolicy{InitialBackoff: time.Second, Jitter: 0.5}
+    for i := 0; i < 100; i++ {
+        if got := p.backoff(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+            t.Fatalf("jitter fuera de rango: %v", got)
+        }
+    }
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+    p := RetryPolicy{
+        RetryableErrors:  []int{ErrConnectionFailed},
+        RetryableReplies: []int{421, 5},
+    }
+    cases := []struct {
+        name string
+        err  error
+        want bool
+    }{
+        {"nil", nil, false},
+        {"código listado", errorf(ErrConnectionFailed, "error conectando"), true},
+        {"código no listado", errorf(ErrInvalidScheme, "esquema inválido"), false},
+        {"respuesta exacta", replyError(ErrDataTransfer, 421, "Servicio no disponible", "error"), true},
+        {"respuesta no listada", replyError(ErrDataTransfer, 450, "Ocupado", "error"), false},
+        {"clase de respuesta", replyError(ErrDataTransfer, 550, "No existe", "error"), true},
+        // Con respuesta del servidor solo cuenta la respuesta, no el código
+        {"respuesta con código listado", replyError(ErrConnectionFailed, 450, "Ocupado", "error"), false},
+        {"error ajeno", errors.New("otro"), false},
+    }
+    for _, c := range cases {
+        if got := p.Retryable(c.err); got != c.want {
+            t.Errorf("%s: Retryable = %v, se esperaba %v", c.name, got, c.want)
+        }
+    }
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+    p := RetryPolicy{MaxAttempts: 3, RetryableErrors: []int{ErrConnectionFailed}}
+    transient := errorf(ErrConnectionFailed, "error conectando")
+
+    calls := 0
+    err := p.do(context.Background(), func() error {
+        calls++
+        return transient
+    })
+    if calls != 3 || ErrorCode(err) != ErrConnectionFailed {
+        t.Errorf("agotando intentos: %d llamadas, error %v", calls, err)
+    }
+
+    calls = 0
+    err = p.do(context.Background(), func() error {
+        calls++
+        if calls < 2 {
+            return transient
+        }
+        return nil
+    })
+    if calls != 2 || err != nil {
+        t.Errorf("éxito al segundo intento: %d llamadas, error %v", calls, err)
+    }
+
+    calls = 0
+    err = p.do(context.Background(), func() error {
+        calls++
+        return errorf(ErrInvalidScheme, "esquema inválido")
+    })
+    if calls != 1 || ErrorCode(err) != ErrInvalidScheme {
+        t.Errorf("error no reintentable: %d llamadas, error %v", calls, err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    p.InitialBackoff = time.Hour
+    calls = 0
+    err = p.do(ctx, func() error {
+        calls++
+        cancel()
+        return transient
+    })
+    if calls != 1 || ErrorCode(err) != ErrCanceled {
+        t.Errorf("cancelado: %d llamadas, error %v", calls, err)
+    }
+}
+
+// seekFS anota los desplazamientos a los que el servidor reanuda cada
+// archivo, para comprobar que el reintento usó REST.
+type seekFS struct {
+    server.FileSystem
+    mu      sync.Mutex
+    offsets []int64
+}
+
+func (f *seekFS) OpenFile(name string, flag int) (server.File, error) {
+    file, err := f.FileSystem.OpenFile(name, flag)
+    if err != nil {
+        return nil, err
+    }
+    return &seekFile{File: file, fs: f}, nil
+}
+
+func (f *seekFS) resumed() []int64 {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]int64(nil), f.offsets...)
+}
+
+type seekFile struct {
+    server.File
+    fs *seekFS
+}
+
+func (f *seekFile) Seek(offset int64, whence int) (int64, error) {
+    if offset > 0 && whence == io.SeekStart {
+        f.fs.mu.Lock()
+        f.fs.offsets = append(f.fs.offsets, offset)
+        f.fs.mu.Unlock()
+    }
+    return f.File.Seek(offset, whence)
+}
+
+// resumePolicy reintenta sin esperas los cortes de la conexión de datos.
+var resumePolicy = RetryPolicy{
+    MaxAttempts:      3,
+    RetryableErrors:  []int{ErrConnectionFailed, ErrInitialRead, ErrDataTransfer, ErrTransferConfirm},
+    RetryableReplies: []int{4},
+}
+
+// cutFault corta la primera transferencia del comando tras 64KB.
+func cutFault(command string) server.Fault {
+    return server.Fault{Command: command, Times: 1, DataLimit: 64 << 10,
+        DataReply: "421 Servicio no disponible", CloseControl: true}
+}
+
+// resetFault corta con RST la primera transferencia del comando tras 64KB,
+// sin que el servidor llegue a responder antes del error.
+func resetFault(command string) server.Fault {
+    return server.Fault{Command: command, Times: 1, DataLimit: 64 << 10, DataReset: true}
+}
+
+// faultServer sirve fsys con los fallos indicados, fijados antes de Listen.
+func faultServer(t *testing.T, fsys server.FileSystem, faults ...server.Fault) *server.Server {
+    t.Helper()
+    srv := server.New(fsys, map[string]string{"u": "p"})
+    srv.Faults = faults
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { srv.Close() })
+    return srv
+}
+
+// testResumedDownload descarga con policy un archivo cuyo primer RETR sufre
+// fault y comprueba que el reintento continuó con REST.
+func testResumedDownload(t *testing.T, fault server.Fault, policy RetryPolicy) {
+    data := make([]byte, 256<<10)
+    rand.Read(data)
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", data)
+    fsys := &seekFS{FileSystem: mem}
+    srv := faultServer(t, fsys, fault)
+
+    got, err := GetFTPBytes(srv.URL("u", "p", "/a.bin"), WithRetry(policy))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(got, data) {
+        t.Fatalf("contenido distinto: %d bytes de %d", len(got), len(data))
+    }
+    offsets := fsys.resumed()
+    if len(offsets) != 1 || offsets[0] <= 0 || offsets[0] > 64<<10 {
+        t.Fatalf("la descarga no se reanudó con REST: %v", offsets)
+    }
+}
+
+// testResumedUpload es testResumedDownload para STOR.
+func testResumedUpload(t *testing.T, fault server.Fault, policy RetryPolicy) {
+    data := make([]byte, 256<<10)
+    rand.Read(data)
+    mem := server.NewMemFS()
+    fsys := &seekFS{FileSystem: mem}
+    srv := faultServer(t, fsys, fault)
+
+    err := PutFTPFile(base64.StdEncoding.EncodeToString(data), srv.URL("u", "p", "/a.bin"), WithRetry(policy))
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, _ := mem.ReadFile("/a.bin")
+    if !bytes.Equal(got, data) {
+        t.Fatalf("contenido distinto: %d bytes de %d", len(got), len(data))
+    }
+    if offsets := fsys.resumed(); len(offsets) != 1 || offsets[0] <= 0 {
+        t.Fatalf("la subida no se reanudó con REST: %v", offsets)
+    }
+}
+
+func TestRetryResumesDownload(t *testing.T) {
+    testResumedDownload(t, cutFault("RETR"), resumePolicy)
+}
+
+func TestRetryResumesUpload(t *testing.T) {
+    testResumedUpload(t, cutFault("STOR"), resumePolicy)
+}
+
+// TestDefaultRetryResumesAfterReset comprueba que la política por defecto
+// reintenta un corte de la conexión de datos sin respuesta del servidor.
+func TestDefaultRetryResumesAfterReset(t *testing.T) {
+    policy := DefaultRetryPolicy()
+    policy.InitialBackoff = time.Millisecond
+    policy.Jitter = 0
+
+    // Sin reintentos el corte llega como ErrDataTransfer sin respuesta
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", make([]byte, 256<<10))
+    srv := faultServer(t, mem, resetFault("RETR"), resetFault("STOR"))
+    single := WithRetry(RetryPolicy{MaxAttempts: 1})
+    if _, err := GetFTPBytes(srv.URL("u", "p", "/a.bin"), single); ErrorCode(err) != ErrDataTransfer || ReplyCode(err) != 0 {
+        t.Fatalf("descarga cortada: %v", err)
+    }
+    if err := PutFTPBytes(make([]byte, 4<<20), srv.URL("u", "p", "/b.bin"), single); ErrorCode(err) != ErrDataTransfer || ReplyCode(err) != 0 {
+        t.Fatalf("subida cortada: %v", err)
+    }
+
+    t.Run("RETR", func(t *testing.T) { testResumedDownload(t, resetFault("RETR"), policy) })
+    t.Run("STOR", func(t *testing.T) { testResumedUpload(t, resetFault("STOR"), policy) })
+}
+
+func TestRetryWithoutPolicyFails(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.WriteFile("/a.bin", make([]byte, 256<<10))
+    srv := faultServer(t, mem, cutFault("RETR"))
+
+    if _, err := GetFTPBytes(srv.URL("u", "p", "/a.bin"), WithRetry(RetryPolicy{MaxAttempts: 1})); err == nil {
+        t.Fatal("la descarga cortada no devolvió error")
+    }
+}
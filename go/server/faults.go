@@ -0,0 +1,199 @@
+package server
+
+import (
+    "crypto/tls"
+    "errors"
+    "net"
+    "strings"
+    "time"
+)
+
+// Fault altera la respuesta del Server a un comando para simular servidores
+// defectuosos. Los campos vacíos no cambian nada.
+type Fault struct {
+    // Command es el verbo afectado ("RETR"); "CONNECT" es el saludo inicial
+    // y "" cualquier comando.
+    Command string
+    // After omite las primeras After apariciones del comando, contadas en
+    // todas las sesiones del servidor, y Times limita cuántas se alteran
+    // (0 todas). Así {After: 0, Times: 1} solo falla el primer intento.
+    After int
+    Times int
+
+    // Reply sustituye la ejecución del comando por esta respuesta literal;
+    // puede tener varias líneas separadas por "\n".
+    Reply string
+    // Multiline antepone estas líneas a la respuesta, con el mismo código,
+    // para convertirla en multilínea.
+    Multiline []string
+    // Delay es la pausa antes de responder.
+    Delay time.Duration
+    // Split envía cada respuesta en trozos de Split bytes, con una pausa de
+    // Delay (o 10ms) entre ellos.
+    Split int
+    // CloseControl cierra la conexión de control después de responder.
+    CloseControl bool
+
+    // PasvHost es la IP anunciada en PASV en lugar de la real.
+    PasvHost string
+    // DataLimit corta la conexión de datos tras DataLimit bytes y responde
+    // DataReply (un 426 si está vacío).
+    DataLimit int64
+    DataReply string
+    // DataReset corta la conexión de datos con RST en lugar de cerrarla, de
+    // modo que el cliente recibe un error de red y no un fin de datos.
+    DataReset bool
+    // EarlyComplete envía el 226 antes de terminar de escribir los datos.
+    EarlyComplete bool
+    // DripBytes escribe los datos en trozos de DripBytes con DripDelay entre
+    // ellos.
+    DripBytes int
+    DripDelay time.Duration
+}
+
+// Scenario es un conjunto de fallos con nombre.
+type Scenario struct {
+    Name   string
+    Faults []Fault
+}
+
+// Scenarios devuelve los comportamientos anómalos vistos en servidores
+// reales, listos para aplicarse a un Server con Faults.
+func Scenarios() []Scenario {
+    return []Scenario{
+        {Name: "multiline-replies", Faults: []Fault{
+            {Command: "CONNECT", Multiline: []string{"Bienvenido", " 220 sangrado que no termina"}},
+            {Command: "PASS", Multiline: []string{"Aviso legal", "Uso monitorizado"}},
+            {Command: "CWD", Multiline: []string{"Directorio con README"}},
+            {Command: "SIZE", Multiline: []string{"Tamaño exacto"}},
+        }},
+        {Name: "split-replies", Faults: []Fault{
+            {Split: 3, Delay: 2 * time.Millisecond},
+        }},
+        // Tras NAT suele fallar también EPSV, así que el cliente usa PASV
+        {Name: "pasv-wrong-ip", Faults: []Fault{
+            {Command: "EPSV", Reply: "502 EPSV no disponible"},
+            {Command: "PASV", PasvHost: "10.255.255.1"},
+        }},
+        {Name: "pasv-zero-ip", Faults: []Fault{
+            {Command: "EPSV", Reply: "502 EPSV no disponible"},
+            {Command: "PASV", PasvHost: "0.0.0.0"},
+        }},
+        {Name: "421-mid-transfer", Faults: []Fault{
+            {Command: "RETR", Times: 1, DataLimit: 1024, DataReply: "421 Servicio no disponible", CloseControl: true},
+            {Command: "STOR", Times: 1, DataLimit: 1024, DataReply: "421 Servicio no disponible", CloseControl: true},
+        }},
+        {Name: "226-before-eof", Faults: []Fault{
+            {Command: "RETR", EarlyComplete: true, DripBytes: 512, DripDelay: time.Millisecond},
+            {Command: "LIST", EarlyComplete: true},
+        }},
+        {Name: "slow-drip", Faults: []Fault{
+            {Command: "RETR", DripBytes: 64, DripDelay: time.Millisecond},
+            {Command: "LIST", DripBytes: 8, DripDelay: time.Millisecond},
+        }},
+        {Name: "busy-first-login", Faults: []Fault{
+            {Command: "CONNECT", Times: 1, Reply: "421 Demasiadas conexiones", CloseControl: true},
+        }},
+        {Name: "transient-425", Faults: []Fault{
+            {Command: "RETR", Times: 1, Reply: "425 No se pudo abrir la conexión de datos"},
+            {Command: "STOR", Times: 1, Reply: "425 No se pudo abrir la conexión de datos"},
+        }},
+    }
+}
+
+// fault devuelve el fallo que corresponde a esta aparición de verb, o nil.
+func (s *Server) fault(verb string) *Fault {
+    if len(s.Faults) == 0 {
+        return nil
+    }
+
+    s.faultMu.Lock()
+    defer s.faultMu.Unlock()
+    if s.seen == nil {
+        s.seen = make(map[string]int)
+    }
+    n := s.seen[verb]
+    s.seen[verb]++
+
+    for i := range s.Faults {
+        f := &s.Faults[i]
+        if f.Command != "" && !strings.EqualFold(f.Command, verb) {
+            continue
+        }
+        if n < f.After || (f.Times > 0 && n >= f.After+f.Times) {
+            continue
+        }
+        return f
+    }
+    return nil
+}
+
+var errFaultCut = errors.New("server: conexión de datos cortada")
+
+// faultConn aplica DataLimit y DripBytes a una conexión de datos.
+type faultConn struct {
+    net.Conn
+    fault *Fault
+    n     int64
+}
+
+func (c *faultConn) Read(p []byte) (int, error) {
+    if c.fault.DataLimit > 0 {
+        if c.n >= c.fault.DataLimit {
+            c.cut()
+            return 0, errFaultCut
+        }
+        if rest := c.fault.DataLimit - c.n; int64(len(p)) > rest {
+            p = p[:rest]
+        }
+    }
+    n, err := c.Conn.Read(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// cut cierra la conexión al llegar a DataLimit, con RST si DataReset.
+func (c *faultConn) cut() {
+    if c.fault.DataReset {
+        conn := c.Conn
+        if t, ok := conn.(*tls.Conn); ok {
+            conn = t.NetConn()
+        }
+        if tcp, ok := conn.(*net.TCPConn); ok {
+            tcp.SetLinger(0)
+        }
+    }
+    c.Conn.Close()
+}
+
+func (c *faultConn) Write(p []byte) (int, error) {
+    written := 0
+    for len(p) > 0 {
+        chunk := p
+        if c.fault.DripBytes > 0 && len(chunk) > c.fault.DripBytes {
+            chunk = chunk[:c.fault.DripBytes]
+        }
+        if c.fault.DataLimit > 0 {
+            rest := c.fault.DataLimit - c.n
+            if rest <= 0 {
+                c.cut()
+                return written, errFaultCut
+            }
+            if int64(len(chunk)) > rest {
+                chunk = chunk[:rest]
+            }
+        }
+
+        n, err := c.Conn.Write(chunk)
+        written += n
+        c.n += int64(n)
+        if err != nil {
+            return written, err
+        }
+        p = p[n:]
+        if c.fault.DripDelay > 0 && len(p) > 0 {
+            time.Sleep(c.fault.DripDelay)
+        }
+    }
+    return written, nil
+}
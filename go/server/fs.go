@@ -0,0 +1,353 @@
+package server
+
+import (
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// File es un archivo abierto del FileSystem; *os.File lo cumple.
+type File interface {
+    io.Reader
+    io.Writer
+    io.Seeker
+    io.Closer
+}
+
+// FileSystem es el almacenamiento que sirve el Server. Las rutas llegan
+// siempre limpias y absolutas, con "/" como separador ("/dir/archivo").
+type FileSystem interface {
+    // OpenFile abre name con los flags de os.OpenFile (O_RDONLY, O_CREATE,
+    // O_TRUNC, O_APPEND...).
+    OpenFile(name string, flag int) (File, error)
+    Stat(name string) (fs.FileInfo, error)
+    ReadDir(name string) ([]fs.FileInfo, error)
+    Mkdir(name string) error
+    Remove(name string) error
+    Rename(oldname, newname string) error
+}
+
+// DirFS sirve el directorio local root; las rutas no pueden salir de él.
+type DirFS string
+
+func (d DirFS) local(name string) string {
+    return filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (d DirFS) OpenFile(name string, flag int) (File, error) {
+    return os.OpenFile(d.local(name), flag, 0644)
+}
+
+func (d DirFS) Stat(name string) (fs.FileInfo, error) {
+    return os.Stat(d.local(name))
+}
+
+func (d DirFS) ReadDir(name string) ([]fs.FileInfo, error) {
+    entries, err := os.ReadDir(d.local(name))
+    if err != nil {
+        return nil, err
+    }
+    infos := make([]fs.FileInfo, 0, len(entries))
+    for _, entry := range entries {
+        info, err := entry.Info()
+        if err != nil {
+            continue // borrado mientras se listaba
+        }
+        infos = append(infos, info)
+    }
+    return infos, nil
+}
+
+func (d DirFS) Mkdir(name string) error {
+    return os.Mkdir(d.local(name), 0755)
+}
+
+func (d DirFS) Remove(name string) error {
+    return os.Remove(d.local(name))
+}
+
+func (d DirFS) Rename(oldname, newname string) error {
+    return os.Rename(d.local(oldname), d.local(newname))
+}
+
+// MemFS es un FileSystem en memoria, útil para pruebas herméticas.
+type MemFS struct {
+    mu    sync.RWMutex
+    nodes map[string]*memNode
+}
+
+type memNode struct {
+    dir  bool
+    data []byte
+    mod  time.Time
+}
+
+// NewMemFS crea un MemFS que solo contiene el directorio raíz.
+func NewMemFS() *MemFS {
+    return &MemFS{nodes: map[string]*memNode{"/": {dir: true, mod: time.Now()}}}
+}
+
+func clean(name string) string {
+    return path.Clean("/" + name)
+}
+
+func pathError(op, name string, err error) error {
+    return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// parentDir comprueba que exista el directorio que contendría name.
+// Debe llamarse con m.mu tomado.
+func (m *MemFS) parentDir(op, name string) error {
+    parent := m.nodes[path.Dir(name)]
+    if parent == nil {
+        return pathError(op, name, fs.ErrNotExist)
+    }
+    if !parent.dir {
+        return pathError(op, name, errors.New("not a directory"))
+    }
+    return nil
+}
+
+func (m *MemFS) OpenFile(name string, flag int) (File, error) {
+    name = clean(name)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    node := m.nodes[name]
+    switch {
+    case node == nil && flag&os.O_CREATE == 0:
+        return nil, pathError("open", name, fs.ErrNotExist)
+    case node == nil:
+        if err := m.parentDir("open", name); err != nil {
+            return nil, err
+        }
+        node = &memNode{mod: time.Now()}
+        m.nodes[name] = node
+    case flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0:
+        // Como os.OpenFile: un directorio existente también es ErrExist
+        return nil, pathError("open", name, fs.ErrExist)
+    case node.dir && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+        return nil, pathError("open", name, errors.New("is a directory"))
+    case flag&os.O_TRUNC != 0:
+        node.data = nil
+        node.mod = time.Now()
+    }
+    return &memFile{fs: m, node: node, flag: flag}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+    name = clean(name)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    node := m.nodes[name]
+    if node == nil {
+        return nil, pathError("stat", name, fs.ErrNotExist)
+    }
+    return node.info(name), nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.FileInfo, error) {
+    name = clean(name)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    node := m.nodes[name]
+    if node == nil {
+        return nil, pathError("readdir", name, fs.ErrNotExist)
+    }
+    if !node.dir {
+        return nil, pathError("readdir", name, errors.New("not a directory"))
+    }
+
+    var infos []fs.FileInfo
+    for p, child := range m.nodes {
+        if p != "/" && path.Dir(p) == name {
+            infos = append(infos, child.info(p))
+        }
+    }
+    sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+    return infos, nil
+}
+
+func (m *MemFS) Mkdir(name string) error {
+    name = clean(name)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.nodes[name] != nil {
+        return pathError("mkdir", name, fs.ErrExist)
+    }
+    if err := m.parentDir("mkdir", name); err != nil {
+        return err
+    }
+    m.nodes[name] = &memNode{dir: true, mod: time.Now()}
+    return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+    name = clean(name)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    node := m.nodes[name]
+    if node == nil || name == "/" {
+        return pathError("remove", name, fs.ErrNotExist)
+    }
+    if node.dir {
+        for p := range m.nodes {
+            if p != name && path.Dir(p) == name {
+                return pathError("remove", name, errors.New("directory not empty"))
+            }
+        }
+    }
+    delete(m.nodes, name)
+    return nil
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+    oldname, newname = clean(oldname), clean(newname)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    node := m.nodes[oldname]
+    if node == nil || oldname == "/" {
+        return pathError("rename", oldname, fs.ErrNotExist)
+    }
+    if err := m.parentDir("rename", newname); err != nil {
+        return err
+    }
+    if strings.HasPrefix(newname, oldname+"/") {
+        return pathError("rename", newname, fs.ErrInvalid)
+    }
+
+    // Mover también el contenido de los directorios
+    for p, child := range m.nodes {
+        if strings.HasPrefix(p, oldname+"/") {
+            delete(m.nodes, p)
+            m.nodes[newname+strings.TrimPrefix(p, oldname)] = child
+        }
+    }
+    delete(m.nodes, oldname)
+    m.nodes[newname] = node
+    return nil
+}
+
+// WriteFile guarda data en name, creando los directorios intermedios.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+    name = clean(name)
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for dir := path.Dir(name); m.nodes[dir] == nil; dir = path.Dir(dir) {
+        m.nodes[dir] = &memNode{dir: true, mod: time.Now()}
+    }
+    if node := m.nodes[name]; node != nil && node.dir {
+        return pathError("write", name, errors.New("is a directory"))
+    }
+    m.nodes[name] = &memNode{data: append([]byte(nil), data...), mod: time.Now()}
+    return nil
+}
+
+// ReadFile devuelve una copia del contenido de name.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+    name = clean(name)
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    node := m.nodes[name]
+    if node == nil {
+        return nil, pathError("read", name, fs.ErrNotExist)
+    }
+    if node.dir {
+        return nil, pathError("read", name, errors.New("is a directory"))
+    }
+    return append([]byte(nil), node.data...), nil
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+    return memInfo{name: path.Base(name), size: int64(len(n.data)), dir: n.dir, mod: n.mod}
+}
+
+type memInfo struct {
+    name string
+    size int64
+    dir  bool
+    mod  time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.mod }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() fs.FileMode {
+    if i.dir {
+        return fs.ModeDir | 0755
+    }
+    return 0644
+}
+
+// memFile lee y escribe directamente sobre el nodo, así los cambios son
+// visibles sin esperar a Close.
+type memFile struct {
+    fs   *MemFS
+    node *memNode
+    flag int
+    pos  int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+    if f.flag&os.O_WRONLY != 0 {
+        return 0, fs.ErrPermission
+    }
+    f.fs.mu.RLock()
+    defer f.fs.mu.RUnlock()
+    if f.pos >= int64(len(f.node.data)) {
+        return 0, io.EOF
+    }
+    n := copy(p, f.node.data[f.pos:])
+    f.pos += int64(n)
+    return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+    if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+        return 0, fs.ErrPermission
+    }
+    f.fs.mu.Lock()
+    defer f.fs.mu.Unlock()
+    if f.flag&os.O_APPEND != 0 {
+        f.pos = int64(len(f.node.data))
+    }
+    if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+        f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+    }
+    copy(f.node.data[f.pos:], p)
+    f.pos += int64(len(p))
+    f.node.mod = time.Now()
+    return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+    f.fs.mu.RLock()
+    size := int64(len(f.node.data))
+    f.fs.mu.RUnlock()
+
+    switch whence {
+    case io.SeekCurrent:
+        offset += f.pos
+    case io.SeekEnd:
+        offset += size
+    }
+    if offset < 0 {
+        return f.pos, fs.ErrInvalid
+    }
+    f.pos = offset
+    return offset, nil
+}
+
+func (f *memFile) Close() error {
+    return nil
+}
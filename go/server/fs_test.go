@@ -0,0 +1,65 @@
+package server
+
+import (
+    "bytes"
+    "errors"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestLFWriterSplitCR(t *testing.T) {
+    var out bytes.Buffer
+    w := &lfWriter{w: &out}
+    // El CRLF llega partido entre dos bloques y el CR final va solo
+    for _, block := range []string{"uno\r", "\ndos\rtres\r"} {
+        if _, err := w.Write([]byte(block)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := w.flush(); err != nil {
+        t.Fatal(err)
+    }
+    if got := out.String(); got != "uno\ndos\rtres\r" {
+        t.Fatalf("conversión %q", got)
+    }
+}
+
+func TestMemFSRenameDir(t *testing.T) {
+    m := NewMemFS()
+    m.WriteFile("/a/b/c.txt", []byte("x"))
+    if err := m.Rename("/a", "/a/b/d"); !errors.Is(err, fs.ErrInvalid) {
+        t.Fatalf("mover dentro de sí mismo: %v", err)
+    }
+    if err := m.Rename("/a", "/z"); err != nil {
+        t.Fatal(err)
+    }
+    if got, err := m.ReadFile("/z/b/c.txt"); err != nil || string(got) != "x" {
+        t.Fatalf("contenido movido %q: %v", got, err)
+    }
+    if _, err := m.Stat("/a/b"); !errors.Is(err, fs.ErrNotExist) {
+        t.Fatalf("el origen sigue existiendo: %v", err)
+    }
+    if err := m.Remove("/z"); err == nil {
+        t.Fatal("se borró un directorio no vacío")
+    }
+}
+
+func TestOpenFileExclusive(t *testing.T) {
+    m := NewMemFS()
+    m.WriteFile("/a.txt", []byte("x"))
+    m.Mkdir("/dir")
+    d := DirFS(t.TempDir())
+    os.WriteFile(filepath.Join(string(d), "a.txt"), []byte("x"), 0o644)
+    os.Mkdir(filepath.Join(string(d), "dir"), 0o755)
+
+    // STOU depende de ErrExist para pasar al siguiente nombre
+    for _, fsys := range []FileSystem{m, d} {
+        for _, name := range []string{"/a.txt", "/dir"} {
+            if _, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL); !errors.Is(err, fs.ErrExist) {
+                t.Errorf("%T %s: %v", fsys, name, err)
+            }
+        }
+    }
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/hex"
+    "hash"
+    "hash/crc32"
+    "io"
+    "os"
+    "sort"
+    "strings"
+)
+
+// hashes son los algoritmos de HASH y sus comandos equivalentes.
+var hashes = map[string]func() hash.Hash{
+    "CRC32":   func() hash.Hash { return crc32.NewIEEE() },
+    "MD5":     md5.New,
+    "SHA-1":   sha1.New,
+    "SHA-256": sha256.New,
+    "SHA-512": sha512.New,
+}
+
+// sumCommands asocia los programas que se pueden ejecutar por SSH con su
+// algoritmo.
+var sumCommands = map[string]string{
+    "md5sum":    "MD5",
+    "sha1sum":   "SHA-1",
+    "sha256sum": "SHA-256",
+    "sha512sum": "SHA-512",
+}
+
+// hashNames devuelve la lista de FEAT HASH con current marcado.
+func hashNames(current string) string {
+    var names []string
+    for name := range hashes {
+        if name == current {
+            name += "*"
+        }
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return strings.Join(names, ";")
+}
+
+// fileHash calcula en hexadecimal el hash algo del archivo name.
+func fileHash(fsys FileSystem, name, algo string) (string, error) {
+    file, err := fsys.OpenFile(name, os.O_RDONLY)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+    h := hashes[algo]()
+    if _, err := io.Copy(h, file); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
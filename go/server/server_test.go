@@ -0,0 +1,404 @@
+package server_test
+
+import (
+    "bytes"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "io"
+    "math/big"
+    "net"
+    "net/textproto"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    ftp "github.com/IngenieroRicardo/ftp/go"
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+var users = map[string]string{"u": "p"}
+
+// start levanta un servidor sobre un MemFS nuevo que se cierra al terminar
+// la prueba. Los fallos se fijan antes de Listen.
+func start(t *testing.T, faults ...server.Fault) (*server.Server, *server.MemFS) {
+    t.Helper()
+    mem := server.NewMemFS()
+    srv := server.New(mem, users)
+    srv.Faults = faults
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { srv.Close() })
+    return srv, mem
+}
+
+// control es una conexión de control sin el cliente del paquete ftp, para
+// comprobar las respuestas exactas del servidor.
+type control struct {
+    t    *testing.T
+    raw  net.Conn
+    conn *textproto.Conn
+}
+
+func dial(t *testing.T, srv *server.Server) *control {
+    t.Helper()
+    raw, err := net.Dial("tcp", srv.Addr())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { raw.Close() })
+    c := &control{t: t, raw: raw, conn: textproto.NewConn(raw)}
+    if _, _, err := c.conn.ReadResponse(220); err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+// login abre una conexión de control ya autenticada.
+func login(t *testing.T, srv *server.Server) *control {
+    t.Helper()
+    c := dial(t, srv)
+    c.expect(331, "USER u")
+    c.expect(230, "PASS p")
+    return c
+}
+
+// cmd envía un comando y devuelve el código y el texto de la respuesta.
+func (c *control) cmd(format string, args ...interface{}) (int, string) {
+    c.t.Helper()
+    if _, err := c.conn.Cmd(format, args...); err != nil {
+        c.t.Fatal(err)
+    }
+    code, msg, err := c.conn.ReadResponse(0)
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    return code, msg
+}
+
+// expect envía un comando y falla si la respuesta no tiene el código want.
+func (c *control) expect(want int, format string, args ...interface{}) string {
+    c.t.Helper()
+    code, msg := c.cmd(format, args...)
+    if code != want {
+        c.t.Fatalf("%s: respuesta %d %s, se esperaba %d", strings.Fields(format)[0], code, msg, want)
+    }
+    return msg
+}
+
+// transfer abre un canal de datos con EPSV, envía el comando y devuelve lo
+// recibido; si upload no es nil lo envía en su lugar.
+func (c *control) transfer(upload []byte, format string, args ...interface{}) []byte {
+    c.t.Helper()
+    msg := c.expect(229, "EPSV")
+    // Entrando en modo pasivo extendido (|||puerto|)
+    fields := strings.Split(msg, "|")
+    if len(fields) < 5 {
+        c.t.Fatalf("respuesta EPSV inválida: %s", msg)
+    }
+    host, _, _ := net.SplitHostPort(c.raw.RemoteAddr().String())
+    data, err := net.Dial("tcp", net.JoinHostPort(host, fields[3]))
+    if err != nil {
+        c.t.Fatal(err)
+    }
+    defer data.Close()
+
+    c.expect(150, format, args...)
+    var received []byte
+    if upload != nil {
+        data.Write(upload)
+        data.Close()
+    } else if received, err = io.ReadAll(data); err != nil {
+        c.t.Fatal(err)
+    }
+    if _, _, err := c.conn.ReadResponse(226); err != nil {
+        c.t.Fatal(err)
+    }
+    return received
+}
+
+func TestRoundTripBinary(t *testing.T) {
+    srv, mem := start(t)
+    data := make([]byte, 1<<20)
+    rand.Read(data)
+    // CR, LF y bytes nulos deben pasar intactos en binario
+    copy(data, "a\r\nb\nc\r\x00")
+
+    if err := ftp.PutFTPBytes(data, srv.URL("u", "p", "/bin/a.bin")+"?mkdirs=1"); err != nil {
+        t.Fatal(err)
+    }
+    if stored, _ := mem.ReadFile("/bin/a.bin"); !bytes.Equal(stored, data) {
+        t.Fatalf("guardado distinto: %d bytes", len(stored))
+    }
+    got, err := ftp.GetFTPBytes(srv.URL("u", "p", "/bin/a.bin"))
+    if err != nil || !bytes.Equal(got, data) {
+        t.Fatalf("descarga distinta: %d bytes, %v", len(got), err)
+    }
+
+    // Y sin el cliente del paquete, con REST
+    c := login(t, srv)
+    c.expect(200, "TYPE I")
+    c.expect(350, "REST 1000")
+    if tail := c.transfer(nil, "RETR /bin/a.bin"); !bytes.Equal(tail, data[1000:]) {
+        t.Fatalf("RETR desde 1000: %d bytes", len(tail))
+    }
+}
+
+func TestRoundTripASCII(t *testing.T) {
+    srv, mem := start(t)
+
+    // El cliente envía CRLF y el servidor guarda LF
+    if err := ftp.PutFTPText("uno\ndos\ntres", srv.URL("u", "p", "/a.txt")); err != nil {
+        t.Fatal(err)
+    }
+    if stored, _ := mem.ReadFile("/a.txt"); string(stored) != "uno\ndos\ntres" {
+        t.Fatalf("guardado %q", stored)
+    }
+    if text, err := ftp.ReadFTPText(srv.URL("u", "p", "/a.txt")); text != "uno\ndos\ntres" || err != nil {
+        t.Fatalf("texto %q, %v", text, err)
+    }
+
+    c := login(t, srv)
+    c.expect(200, "TYPE A")
+    if got := c.transfer(nil, "RETR /a.txt"); !bytes.HasPrefix(got, []byte("uno\r\ndos\r\ntres")) {
+        t.Fatalf("RETR en ASCII: %q", got)
+    }
+    // Los CRLF de una subida en ASCII se guardan como LF
+    c.transfer([]byte("x\r\ny\r\n"), "STOR /b.txt")
+    if stored, _ := mem.ReadFile("/b.txt"); string(stored) != "x\ny\n" {
+        t.Fatalf("STOR en ASCII guardó %q", stored)
+    }
+    c.expect(200, "TYPE I")
+    if got := c.transfer(nil, "RETR /b.txt"); string(got) != "x\ny\n" {
+        t.Fatalf("RETR en binario: %q", got)
+    }
+}
+
+func TestListings(t *testing.T) {
+    srv, mem := start(t)
+    mem.Mkdir("/d")
+    mem.Mkdir("/d/sub")
+    mem.WriteFile("/d/a.txt", []byte("hola"))
+    mem.WriteFile("/d/con espacios.bin", make([]byte, 1234))
+
+    c := login(t, srv)
+    c.expect(200, "TYPE A")
+    list := strings.Split(strings.TrimSpace(string(c.transfer(nil, "LIST /d"))), "\r\n")
+    if len(list) != 3 {
+        t.Fatalf("LIST: %q", list)
+    }
+    for _, line := range list {
+        fields := strings.Fields(line)
+        switch {
+        case strings.HasSuffix(line, " sub"):
+            if !strings.HasPrefix(fields[0], "d") {
+                t.Errorf("LIST directorio: %q", line)
+            }
+        case strings.HasSuffix(line, " con espacios.bin"):
+            if fields[4] != "1234" {
+                t.Errorf("LIST tamaño: %q", line)
+            }
+        case !strings.HasSuffix(line, " a.txt"):
+            t.Errorf("LIST línea inesperada: %q", line)
+        }
+    }
+
+    nlst := strings.Split(strings.TrimSpace(string(c.transfer(nil, "NLST /d"))), "\r\n")
+    sort.Strings(nlst)
+    if want := []string{"a.txt", "con espacios.bin", "sub"}; !reflect.DeepEqual(nlst, want) {
+        t.Errorf("NLST: %q", nlst)
+    }
+
+    mlsd := strings.Split(strings.TrimSpace(string(c.transfer(nil, "MLSD /d"))), "\r\n")
+    sort.Strings(mlsd)
+    if len(mlsd) != 3 || !strings.HasPrefix(mlsd[0], "type=dir;") || !strings.HasSuffix(mlsd[0], "; sub") ||
+        !strings.HasPrefix(mlsd[1], "type=file;size=1234;") || !strings.HasSuffix(mlsd[2], "; a.txt") {
+        t.Errorf("MLSD: %q", mlsd)
+    }
+    c.expect(501, "MLSD /d/a.txt")
+
+    msg := c.expect(250, "MLST /d/a.txt")
+    if !strings.Contains(msg, "type=file;size=4;modify=") || !strings.Contains(msg, "; /d/a.txt") {
+        t.Errorf("MLST: %q", msg)
+    }
+    c.expect(550, "MLST /d/no-existe")
+
+    // El cliente usa MLSD y MLST
+    entries, err := ftp.ReadFTPDir(srv.URL("u", "p", "/d"))
+    if err != nil || len(entries) != 3 {
+        t.Fatalf("ReadFTPDir: %+v, %v", entries, err)
+    }
+    info, err := ftp.StatFTPFile(srv.URL("u", "p", "/d/con espacios.bin"))
+    if err != nil || info.Size != 1234 || info.IsDir || info.Name != "con espacios.bin" {
+        t.Errorf("StatFTPFile: %+v, %v", info, err)
+    }
+}
+
+func TestSizeMdtm(t *testing.T) {
+    // Sin MLST el cliente recurre a SIZE y MDTM
+    srv, mem := start(t, server.Fault{Command: "MLST", Reply: "502 No implementado"})
+    before := time.Now().UTC().Truncate(time.Second)
+    mem.WriteFile("/a.bin", make([]byte, 4321))
+    mem.Mkdir("/d")
+
+    c := login(t, srv)
+    if size := c.expect(213, "SIZE /a.bin"); size != "4321" {
+        t.Errorf("SIZE: %q", size)
+    }
+    c.expect(550, "SIZE /d")
+    c.expect(550, "SIZE /no-existe")
+
+    stamp := c.expect(213, "MDTM /a.bin")
+    mod, err := time.Parse("20060102150405", stamp)
+    if err != nil || mod.Before(before) || mod.After(time.Now().UTC()) {
+        t.Errorf("MDTM: %q", stamp)
+    }
+    c.expect(550, "MDTM /no-existe")
+
+    info, err := ftp.StatFTPFile(srv.URL("u", "p", "/a.bin"))
+    if err != nil || info.Size != 4321 || !info.ModTime.Equal(mod) {
+        t.Errorf("StatFTPFile: %+v, %v", info, err)
+    }
+}
+
+func TestMkdDeleRename(t *testing.T) {
+    srv, mem := start(t)
+
+    c := login(t, srv)
+    if msg := c.expect(257, "MKD /nuevo"); !strings.Contains(msg, `"/nuevo"`) {
+        t.Errorf("MKD: %q", msg)
+    }
+    c.expect(550, "MKD /nuevo")
+    c.expect(550, "MKD /falta/padre")
+
+    mem.WriteFile("/nuevo/a.txt", []byte("a"))
+    c.expect(503, "RNTO /b.txt")
+    c.expect(350, "RNFR /nuevo/a.txt")
+    c.expect(250, "RNTO /nuevo/b.txt")
+    if _, err := mem.ReadFile("/nuevo/a.txt"); err == nil {
+        t.Error("RNFR/RNTO dejó el original")
+    }
+    if got, _ := mem.ReadFile("/nuevo/b.txt"); string(got) != "a" {
+        t.Errorf("RNFR/RNTO: %q", got)
+    }
+    c.expect(550, "RNFR /no-existe")
+
+    c.expect(550, "DELE /nuevo")
+    c.expect(250, "DELE /nuevo/b.txt")
+    c.expect(550, "DELE /nuevo/b.txt")
+    c.expect(250, "RMD /nuevo")
+
+    // Lo mismo con el cliente
+    if err := ftp.CreateFTPDir(srv.URL("u", "p", "/x")); err != nil {
+        t.Fatal(err)
+    }
+    if existed, err := ftp.EnsureFTPDir(srv.URL("u", "p", "/x")); !existed || err != nil {
+        t.Errorf("EnsureFTPDir: %v, %v", existed, err)
+    }
+    mem.WriteFile("/x/a.txt", []byte("a"))
+    if err := ftp.RenameFTPFile(srv.URL("u", "p", "/x/a.txt"), "b.txt"); err != nil {
+        t.Fatal(err)
+    }
+    if err := ftp.DeleteFTPFile(srv.URL("u", "p", "/x/b.txt")); err != nil {
+        t.Fatal(err)
+    }
+    if err := ftp.DeleteFTPFile(srv.URL("u", "p", "/x/b.txt")); ftp.ReplyCode(err) != 550 {
+        t.Errorf("borrar dos veces: %v", err)
+    }
+}
+
+func TestLogin(t *testing.T) {
+    srv, _ := start(t)
+
+    c := dial(t, srv)
+    c.expect(530, "LIST")
+    c.expect(503, "PASS p")
+    c.expect(331, "USER u")
+    c.expect(530, "PASS mala")
+    c.expect(331, "USER u")
+    c.expect(230, "PASS p")
+
+    if _, err := ftp.GetFTPBytes(srv.URL("u", "mala", "/a")); ftp.ErrorCode(err) != ftp.ErrPassAuth {
+        t.Errorf("contraseña errónea: %v", err)
+    }
+}
+
+// selfSigned genera un certificado para 127.0.0.1 válido durante la prueba.
+func selfSigned(t *testing.T) tls.Certificate {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject:      pkix.Name{CommonName: "127.0.0.1"},
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestAuthTLS(t *testing.T) {
+    mem := server.NewMemFS()
+    srv := server.New(mem, users)
+    srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{selfSigned(t)}}
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    c := dial(t, srv)
+    c.expect(503, "PBSZ 0")
+    c.expect(504, "AUTH KERBEROS")
+    c.expect(234, "AUTH TLS")
+    conn := tls.Client(c.raw, &tls.Config{InsecureSkipVerify: true})
+    if err := conn.Handshake(); err != nil {
+        t.Fatal(err)
+    }
+    c.raw, c.conn = conn, textproto.NewConn(conn)
+    c.expect(331, "USER u")
+    c.expect(230, "PASS p")
+    c.expect(200, "PBSZ 0")
+    c.expect(200, "PROT P")
+
+    data := bytes.Repeat([]byte("cifrado\n"), 10000)
+    url := srv.URL("u", "p", "/tls.bin") + "?tls=explicit&insecure=1"
+    if err := ftp.PutFTPBytes(data, url); err != nil {
+        t.Fatal(err)
+    }
+    got, err := ftp.GetFTPBytes(url)
+    if err != nil || !bytes.Equal(got, data) {
+        t.Fatalf("descarga con TLS: %d bytes, %v", len(got), err)
+    }
+    names, err := ftp.ListFTPDir(srv.URL("u", "p", "/") + "?tls=explicit&insecure=1")
+    if err != nil || !reflect.DeepEqual(names, []string{"tls.bin"}) {
+        t.Errorf("listado con TLS: %q, %v", names, err)
+    }
+
+    // Sin insecure el certificado autofirmado se rechaza
+    if _, err := ftp.GetFTPBytes(srv.URL("u", "p", "/tls.bin") + "?tls=explicit"); ftp.ErrorCode(err) != ftp.ErrConnectionFailed {
+        t.Errorf("certificado no válido: %v", err)
+    }
+}
+
+func TestAuthTLSUnavailable(t *testing.T) {
+    srv, _ := start(t)
+    c := dial(t, srv)
+    c.expect(502, "AUTH TLS")
+
+    if _, err := ftp.GetFTPBytes(srv.URL("u", "p", "/a") + "?tls=explicit"); ftp.ReplyCode(err) != 502 {
+        t.Errorf("AUTH TLS sin TLS: %v", err)
+    }
+}
@@ -0,0 +1,1070 @@
+package server
+
+import (
+    "bufio"
+    "bytes"
+    "compress/zlib"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "net"
+    "os"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    idleTimeout = 5 * time.Minute
+    dataTimeout = 10 * time.Second
+)
+
+// session es una conexión de control de un cliente.
+type session struct {
+    srv    *Server
+    conn   net.Conn
+    reader *bufio.Reader
+
+    user   string
+    logged bool
+    dir    string
+    binary bool
+    rest   int64
+    from   string // ruta pendiente de RNTO
+    pasv   net.Listener
+    active string // dirección de PORT o EPRT
+    tls    bool // control cifrado con AUTH TLS
+    prot   bool // datos cifrados con PROT P
+    quit   bool
+    fault  *Fault // fallo simulado del comando en curso
+    hash   string // algoritmo de HASH elegido con OPTS HASH
+    zmode  bool   // MODE Z: datos comprimidos con zlib
+}
+
+type command struct {
+    fn   func(*session, string)
+    auth bool // requiere sesión iniciada
+}
+
+var commands = map[string]command{
+    "USER": {(*session).handleUser, false},
+    "PASS": {(*session).handlePass, false},
+    "AUTH": {(*session).handleAuth, false},
+    "PBSZ": {(*session).handlePbsz, false},
+    "PROT": {(*session).handleProt, false},
+    "SYST": {(*session).handleSyst, false},
+    "FEAT": {(*session).handleFeat, false},
+    "OPTS": {(*session).handleOpts, false},
+    "NOOP": {(*session).handleNoop, false},
+    "QUIT": {(*session).handleQuit, false},
+    "PWD":  {(*session).handlePwd, true},
+    "XPWD": {(*session).handlePwd, true},
+    "CWD":  {(*session).handleCwd, true},
+    "XCWD": {(*session).handleCwd, true},
+    "CDUP": {(*session).handleCdup, true},
+    "TYPE": {(*session).handleType, true},
+    "MODE": {(*session).handleMode, true},
+    "STRU": {(*session).handleStru, true},
+    "PASV": {(*session).handlePasv, true},
+    "EPSV": {(*session).handleEpsv, true},
+    "PORT": {(*session).handlePort, true},
+    "EPRT": {(*session).handleEprt, true},
+    "REST": {(*session).handleRest, true},
+    "RETR": {(*session).handleRetr, true},
+    "STOR": {(*session).handleStor, true},
+    "APPE": {(*session).handleAppe, true},
+    "STOU": {(*session).handleStou, true},
+    "LIST": {(*session).handleList, true},
+    "NLST": {(*session).handleNlst, true},
+    "MLSD": {(*session).handleMlsd, true},
+    "MLST": {(*session).handleMlst, true},
+    "MKD":  {(*session).handleMkd, true},
+    "XMKD": {(*session).handleMkd, true},
+    "RMD":  {(*session).handleRmd, true},
+    "XRMD": {(*session).handleRmd, true},
+    "DELE": {(*session).handleDele, true},
+    "RNFR": {(*session).handleRnfr, true},
+    "RNTO": {(*session).handleRnto, true},
+    "SIZE": {(*session).handleSize, true},
+    "MDTM": {(*session).handleMdtm, true},
+    // Hashes de archivos: HASH y los comandos X de cada algoritmo
+    "HASH":    {(*session).handleHash, true},
+    "XCRC":    {xhash("CRC32"), true},
+    "XMD5":    {xhash("MD5"), true},
+    "XSHA1":   {xhash("SHA-1"), true},
+    "XSHA256": {xhash("SHA-256"), true},
+    "XSHA512": {xhash("SHA-512"), true},
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+    return &session{srv: srv, conn: conn, reader: bufio.NewReader(conn), dir: "/"}
+}
+
+func (s *session) serve() {
+    defer s.close()
+
+    if s.srv.ImplicitTLS && s.srv.TLSConfig != nil {
+        conn := tls.Server(s.conn, s.srv.TLSConfig)
+        conn.SetDeadline(time.Now().Add(dataTimeout))
+        if err := conn.Handshake(); err != nil {
+            return
+        }
+        conn.SetDeadline(time.Time{})
+        s.conn = conn
+        s.reader = bufio.NewReader(conn)
+        s.tls = true
+    }
+
+    welcome := s.srv.Welcome
+    if welcome == "" {
+        welcome = "Servicio listo"
+    }
+    if !s.runFault("CONNECT") {
+        s.reply(220, "%s", welcome)
+    }
+    s.endFault()
+
+    for !s.quit {
+        s.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+        line, err := s.reader.ReadString('\n')
+        if err != nil {
+            return
+        }
+        verb, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+        verb = strings.ToUpper(verb)
+
+        if s.runFault(verb) {
+            s.endFault()
+            continue
+        }
+
+        cmd, ok := commands[verb]
+        switch {
+        case !ok:
+            s.reply(502, "Comando %s no implementado", verb)
+        case cmd.auth && !s.logged:
+            s.reply(530, "Inicie sesión con USER y PASS")
+        default:
+            if verb != "RNTO" {
+                s.from = ""
+            }
+            cmd.fn(s, arg)
+        }
+        s.endFault()
+    }
+}
+
+// runFault activa el fallo simulado que toque a verb e indica si ya se
+// respondió en lugar del comando.
+func (s *session) runFault(verb string) bool {
+    s.fault = s.srv.fault(verb)
+    if s.fault == nil || s.fault.Reply == "" {
+        return false
+    }
+    lines := strings.Split(strings.TrimRight(s.fault.Reply, "\r\n"), "\n")
+    for i, line := range lines {
+        lines[i] = strings.TrimRight(line, "\r")
+    }
+    s.write(strings.Join(lines, "\r\n") + "\r\n")
+    return true
+}
+
+func (s *session) endFault() {
+    if s.fault != nil && s.fault.CloseControl {
+        s.quit = true
+    }
+    s.fault = nil
+}
+
+// write envía texto por el control aplicando Delay y Split del fallo activo.
+func (s *session) write(text string) {
+    s.conn.SetWriteDeadline(time.Now().Add(dataTimeout))
+    f := s.fault
+    if f == nil {
+        io.WriteString(s.conn, text)
+        return
+    }
+    if f.Delay > 0 {
+        time.Sleep(f.Delay)
+    }
+    if f.Split <= 0 {
+        io.WriteString(s.conn, text)
+        return
+    }
+    pause := f.Delay
+    if pause <= 0 {
+        pause = 10 * time.Millisecond
+    }
+    for len(text) > 0 {
+        n := min(f.Split, len(text))
+        io.WriteString(s.conn, text[:n])
+        text = text[n:]
+        if len(text) > 0 {
+            time.Sleep(pause)
+        }
+    }
+}
+
+func (s *session) close() {
+    if s.pasv != nil {
+        s.pasv.Close()
+    }
+    s.conn.Close()
+}
+
+func (s *session) reply(code int, format string, args ...interface{}) {
+    var b strings.Builder
+    if s.fault != nil {
+        for _, line := range s.fault.Multiline {
+            fmt.Fprintf(&b, "%d-%s\r\n", code, line)
+        }
+    }
+    fmt.Fprintf(&b, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+    s.write(b.String())
+}
+
+// replyLines envía una respuesta multilínea: la primera línea como título y
+// el resto con sangría.
+func (s *session) replyLines(code int, title string, lines []string, end string) {
+    var b strings.Builder
+    fmt.Fprintf(&b, "%d-%s\r\n", code, title)
+    for _, line := range lines {
+        fmt.Fprintf(&b, " %s\r\n", line)
+    }
+    fmt.Fprintf(&b, "%d %s\r\n", code, end)
+    s.write(b.String())
+}
+
+// replyError responde 550 con un mensaje según el error del FileSystem.
+func (s *session) replyError(err error) {
+    switch {
+    case errors.Is(err, fs.ErrNotExist):
+        s.reply(550, "No existe el archivo o directorio")
+    case errors.Is(err, fs.ErrExist):
+        s.reply(550, "Ya existe")
+    case errors.Is(err, fs.ErrPermission):
+        s.reply(550, "Permiso denegado")
+    default:
+        s.reply(550, "Acción no realizada")
+    }
+}
+
+// resolve convierte arg en una ruta absoluta respecto al directorio actual.
+func (s *session) resolve(arg string) string {
+    if strings.HasPrefix(arg, "/") {
+        return path.Clean(arg)
+    }
+    return path.Join(s.dir, arg)
+}
+
+func (s *session) handleUser(arg string) {
+    s.user = arg
+    s.logged = false
+    s.reply(331, "Usuario correcto, falta la contraseña")
+}
+
+func (s *session) handlePass(arg string) {
+    if s.user == "" {
+        s.reply(503, "Envíe USER primero")
+        return
+    }
+    if !s.srv.authenticate(s.user, arg) {
+        s.reply(530, "Autenticación fallida")
+        return
+    }
+    s.logged = true
+    s.reply(230, "Sesión iniciada")
+}
+
+func (s *session) handleAuth(arg string) {
+    if s.srv.TLSConfig == nil {
+        s.reply(502, "TLS no disponible")
+        return
+    }
+    if mode := strings.ToUpper(arg); mode != "TLS" && mode != "SSL" {
+        s.reply(504, "Mecanismo %s no soportado", arg)
+        return
+    }
+    s.reply(234, "Iniciando TLS")
+
+    conn := tls.Server(s.conn, s.srv.TLSConfig)
+    conn.SetDeadline(time.Now().Add(dataTimeout))
+    if err := conn.Handshake(); err != nil {
+        s.quit = true
+        return
+    }
+    conn.SetDeadline(time.Time{})
+    s.conn = conn
+    s.reader = bufio.NewReader(conn)
+    s.tls = true
+}
+
+func (s *session) handlePbsz(arg string) {
+    if !s.tls {
+        s.reply(503, "Use AUTH TLS primero")
+        return
+    }
+    s.reply(200, "PBSZ=0")
+}
+
+func (s *session) handleProt(arg string) {
+    if !s.tls {
+        s.reply(503, "Use AUTH TLS primero")
+        return
+    }
+    switch strings.ToUpper(arg) {
+    case "P":
+        s.prot = true
+    case "C":
+        s.prot = false
+    default:
+        s.reply(504, "Nivel de protección no soportado")
+        return
+    }
+    s.reply(200, "Protección %s", strings.ToUpper(arg))
+}
+
+func (s *session) handleSyst(arg string) {
+    s.reply(215, "UNIX Type: L8")
+}
+
+func (s *session) handleFeat(arg string) {
+    features := []string{"EPSV", "HASH " + hashNames(s.hashAlgo()), "MDTM", "MLST type*;size*;modify*;", "MODE Z", "PASV", "REST STREAM", "SIZE", "UTF8",
+        "XCRC", "XMD5", "XSHA1", "XSHA256", "XSHA512"}
+    if s.srv.TLSConfig != nil {
+        features = append(features, "AUTH TLS", "PBSZ", "PROT")
+    }
+    s.replyLines(211, "Extensiones soportadas:", features, "Fin")
+}
+
+func (s *session) handleOpts(arg string) {
+    option, value, _ := strings.Cut(strings.TrimSpace(arg), " ")
+    switch {
+    case strings.EqualFold(arg, "UTF8 ON"):
+        s.reply(200, "UTF8 activado")
+    case strings.EqualFold(option, "HASH") && value == "":
+        s.reply(200, "%s", s.hashAlgo())
+    case strings.EqualFold(option, "HASH"):
+        value = strings.ToUpper(value)
+        if hashes[value] == nil {
+            s.reply(501, "Algoritmo no soportado")
+            return
+        }
+        s.hash = value
+        s.reply(200, "%s", value)
+    default:
+        s.reply(501, "Opción no soportada")
+    }
+}
+
+// hashAlgo es el algoritmo de HASH en uso, SHA-256 si no se eligió otro.
+func (s *session) hashAlgo() string {
+    if s.hash == "" {
+        return "SHA-256"
+    }
+    return s.hash
+}
+
+func (s *session) handleNoop(arg string) {
+    s.reply(200, "NOOP correcto")
+}
+
+func (s *session) handleQuit(arg string) {
+    s.reply(221, "Adiós")
+    s.quit = true
+}
+
+func (s *session) handlePwd(arg string) {
+    s.reply(257, "\"%s\" es el directorio actual", strings.ReplaceAll(s.dir, "\"", "\"\""))
+}
+
+func (s *session) handleCwd(arg string) {
+    dir := s.resolve(arg)
+    info, err := s.srv.FS.Stat(dir)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if !info.IsDir() {
+        s.reply(550, "No es un directorio")
+        return
+    }
+    s.dir = dir
+    s.reply(250, "Directorio cambiado a %s", dir)
+}
+
+func (s *session) handleCdup(arg string) {
+    s.handleCwd("..")
+}
+
+func (s *session) handleType(arg string) {
+    switch strings.ToUpper(strings.TrimSpace(arg)) {
+    case "A", "A N":
+        s.binary = false
+        s.reply(200, "Tipo ASCII")
+    case "I", "L 8":
+        s.binary = true
+        s.reply(200, "Tipo binario")
+    default:
+        s.reply(504, "Tipo no soportado")
+    }
+}
+
+func (s *session) handleMode(arg string) {
+    switch strings.ToUpper(strings.TrimSpace(arg)) {
+    case "S":
+        s.zmode = false
+        s.reply(200, "Modo S")
+    case "Z":
+        s.zmode = true
+        s.reply(200, "Modo Z")
+    default:
+        s.reply(504, "Modo no soportado")
+    }
+}
+
+func (s *session) handleStru(arg string) {
+    if strings.ToUpper(arg) != "F" {
+        s.reply(504, "Estructura no soportada")
+        return
+    }
+    s.reply(200, "Estructura F")
+}
+
+// listenData abre el puerto pasivo en la misma IP que la conexión de control.
+func (s *session) listenData() (*net.TCPAddr, error) {
+    if s.pasv != nil {
+        s.pasv.Close()
+        s.pasv = nil
+    }
+    s.active = ""
+    local := s.conn.LocalAddr().(*net.TCPAddr)
+    l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local.IP})
+    if err != nil {
+        return nil, err
+    }
+    s.pasv = l
+    return l.Addr().(*net.TCPAddr), nil
+}
+
+func (s *session) handlePasv(arg string) {
+    ip := s.conn.LocalAddr().(*net.TCPAddr).IP.To4()
+    if s.fault != nil && s.fault.PasvHost != "" {
+        ip = net.ParseIP(s.fault.PasvHost).To4()
+    }
+    if ip == nil {
+        s.reply(425, "PASV requiere IPv4, use EPSV")
+        return
+    }
+    addr, err := s.listenData()
+    if err != nil {
+        s.reply(425, "No se pudo abrir el puerto de datos")
+        return
+    }
+    s.reply(227, "Entrando en modo pasivo (%d,%d,%d,%d,%d,%d)",
+        ip[0], ip[1], ip[2], ip[3], addr.Port>>8, addr.Port&0xff)
+}
+
+func (s *session) handleEpsv(arg string) {
+    if strings.EqualFold(arg, "ALL") {
+        s.reply(200, "EPSV ALL aceptado")
+        return
+    }
+    addr, err := s.listenData()
+    if err != nil {
+        s.reply(425, "No se pudo abrir el puerto de datos")
+        return
+    }
+    s.reply(229, "Entrando en modo pasivo extendido (|||%d|)", addr.Port)
+}
+
+// setActive fija la dirección de datos de PORT o EPRT. Solo se admite la IP
+// del cliente para no servir de rebote hacia terceros.
+func (s *session) setActive(ip net.IP, port int) {
+    client := s.conn.RemoteAddr().(*net.TCPAddr)
+    if ip == nil || !ip.Equal(client.IP) || port <= 0 || port > 65535 {
+        s.reply(501, "Dirección de datos no permitida")
+        return
+    }
+    if s.pasv != nil {
+        s.pasv.Close()
+        s.pasv = nil
+    }
+    s.active = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+    s.reply(200, "Modo activo aceptado")
+}
+
+func (s *session) handlePort(arg string) {
+    parts := strings.Split(strings.TrimSpace(arg), ",")
+    if len(parts) != 6 {
+        s.reply(501, "Formato PORT inválido")
+        return
+    }
+    var n [6]int
+    for i, part := range parts {
+        v, err := strconv.Atoi(part)
+        if err != nil || v < 0 || v > 255 {
+            s.reply(501, "Formato PORT inválido")
+            return
+        }
+        n[i] = v
+    }
+    s.setActive(net.IPv4(byte(n[0]), byte(n[1]), byte(n[2]), byte(n[3])), n[4]<<8|n[5])
+}
+
+func (s *session) handleEprt(arg string) {
+    // |protocolo|ip|puerto| con cualquier delimitador
+    arg = strings.TrimSpace(arg)
+    if len(arg) < 2 {
+        s.reply(501, "Formato EPRT inválido")
+        return
+    }
+    fields := strings.Split(arg[1:], arg[:1])
+    if len(fields) < 3 {
+        s.reply(501, "Formato EPRT inválido")
+        return
+    }
+    port, err := strconv.Atoi(fields[2])
+    if err != nil {
+        s.reply(501, "Formato EPRT inválido")
+        return
+    }
+    s.setActive(net.ParseIP(fields[1]), port)
+}
+
+// acceptData abre la conexión de datos: acepta la de PASV o EPSV o conecta a
+// la dirección de PORT o EPRT.
+func (s *session) acceptData() (net.Conn, error) {
+    var conn net.Conn
+    var err error
+    switch {
+    case s.pasv != nil:
+        l := s.pasv
+        s.pasv = nil
+        defer l.Close()
+        l.(*net.TCPListener).SetDeadline(time.Now().Add(dataTimeout))
+        conn, err = l.Accept()
+    case s.active != "":
+        addr := s.active
+        s.active = ""
+        conn, err = net.DialTimeout("tcp", addr, dataTimeout)
+    default:
+        return nil, errors.New("sin PASV ni PORT")
+    }
+    if err != nil {
+        return nil, err
+    }
+    if s.prot {
+        tlsConn := tls.Server(conn, s.srv.TLSConfig)
+        tlsConn.SetDeadline(time.Now().Add(dataTimeout))
+        if err := tlsConn.Handshake(); err != nil {
+            conn.Close()
+            return nil, err
+        }
+        tlsConn.SetDeadline(time.Time{})
+        conn = tlsConn
+    }
+    return conn, nil
+}
+
+// transfer abre la conexión de datos, ejecuta fn y responde 226 o 426.
+func (s *session) transfer(fn func(conn net.Conn) error) {
+    s.transferMsg("Abriendo conexión de datos", fn)
+}
+
+// transferMsg es transfer con otro texto en la respuesta 150.
+func (s *session) transferMsg(msg string, fn func(conn net.Conn) error) {
+    if s.pasv == nil && s.active == "" {
+        s.reply(425, "Use PASV, EPSV, PORT o EPRT primero")
+        return
+    }
+    s.reply(150, "%s", msg)
+    conn, err := s.acceptData()
+    if err != nil {
+        s.reply(425, "No se pudo abrir la conexión de datos")
+        return
+    }
+
+    f := s.fault
+    if f != nil {
+        conn = &faultConn{Conn: conn, fault: f}
+        if f.EarlyComplete {
+            s.reply(226, "Transferencia completa")
+        }
+    }
+    // Los fallos simulados cuentan los bytes comprimidos
+    if s.zmode {
+        conn = &deflateConn{Conn: conn}
+    }
+    err = fn(conn)
+    if closeErr := conn.Close(); err == nil {
+        err = closeErr
+    }
+    switch {
+    case errors.Is(err, errFaultCut) && f.DataReply != "":
+        s.write(f.DataReply + "\r\n")
+    case f != nil && f.EarlyComplete:
+    case err != nil:
+        s.reply(426, "Transferencia interrumpida")
+    default:
+        s.reply(226, "Transferencia completa")
+    }
+}
+
+// deflateConn comprime con zlib lo que se escribe en la conexión de datos y
+// descomprime lo que se lee, para MODE Z.
+type deflateConn struct {
+    net.Conn
+    zr io.ReadCloser
+    zw *zlib.Writer
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+    if c.zr == nil {
+        zr, err := zlib.NewReader(c.Conn)
+        if err != nil {
+            return 0, err
+        }
+        c.zr = zr
+    }
+    return c.zr.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+    if c.zw == nil {
+        c.zw = zlib.NewWriter(c.Conn)
+    }
+    return c.zw.Write(p)
+}
+
+// Close termina el flujo comprimido antes de cerrar la conexión. Un archivo
+// vacío se envía sin datos.
+func (c *deflateConn) Close() error {
+    var err error
+    if c.zw != nil {
+        err = c.zw.Close()
+    }
+    if closeErr := c.Conn.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+func (s *session) handleRest(arg string) {
+    offset, err := strconv.ParseInt(strings.TrimSpace(arg), 10, 64)
+    if err != nil || offset < 0 {
+        s.reply(501, "Posición inválida")
+        return
+    }
+    s.rest = offset
+    s.reply(350, "Reanudando en %d", offset)
+}
+
+func (s *session) handleRetr(arg string) {
+    name := s.resolve(arg)
+    offset := s.rest
+    s.rest = 0
+
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if info.IsDir() {
+        s.reply(550, "Es un directorio")
+        return
+    }
+    file, err := s.srv.FS.OpenFile(name, os.O_RDONLY)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    defer file.Close()
+    if offset > 0 {
+        if _, err := file.Seek(offset, io.SeekStart); err != nil {
+            s.reply(554, "No se puede reanudar en %d", offset)
+            return
+        }
+    }
+
+    s.transfer(func(conn net.Conn) error {
+        var w io.Writer = conn
+        if !s.binary {
+            w = crlfWriter{conn}
+        }
+        _, err := io.Copy(w, file)
+        return err
+    })
+}
+
+func (s *session) handleStor(arg string) {
+    s.store(arg, false)
+}
+
+// handleAppe añade los datos al final del archivo, creándolo si no existe.
+func (s *session) handleAppe(arg string) {
+    s.store(arg, true)
+}
+
+func (s *session) store(arg string, appending bool) {
+    name := s.resolve(arg)
+    offset := s.rest
+    s.rest = 0
+
+    if info, err := s.srv.FS.Stat(name); err == nil && info.IsDir() {
+        s.reply(550, "Es un directorio")
+        return
+    }
+    flag := os.O_WRONLY | os.O_CREATE
+    switch {
+    case appending:
+        flag |= os.O_APPEND
+        offset = 0
+    case offset == 0:
+        flag |= os.O_TRUNC
+    }
+    file, err := s.srv.FS.OpenFile(name, flag)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    defer file.Close()
+    if offset > 0 {
+        if _, err := file.Seek(offset, io.SeekStart); err != nil {
+            s.reply(554, "No se puede reanudar en %d", offset)
+            return
+        }
+    }
+
+    s.transfer(s.receive(file))
+}
+
+// handleStou guarda los datos con un nombre nuevo, basado en arg si lo hay,
+// e indica cuál en la respuesta 150 como pide el RFC 1123.
+func (s *session) handleStou(arg string) {
+    s.rest = 0
+    name := s.resolve("stou")
+    if arg != "" {
+        name = s.resolve(arg)
+    }
+    for i := 0; ; i++ {
+        candidate := name
+        if i > 0 {
+            candidate = fmt.Sprintf("%s.%d", name, i)
+        }
+        file, err := s.srv.FS.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+        if errors.Is(err, fs.ErrExist) {
+            continue
+        }
+        if err != nil {
+            s.replyError(err)
+            return
+        }
+        defer file.Close()
+        s.transferMsg("FILE: "+path.Base(candidate), s.receive(file))
+        return
+    }
+}
+
+// receive copia en file los datos recibidos según el tipo actual.
+func (s *session) receive(file File) func(conn net.Conn) error {
+    return func(conn net.Conn) error {
+        if s.binary {
+            _, err := io.Copy(file, conn)
+            return err
+        }
+        w := &lfWriter{w: file}
+        if _, err := io.Copy(w, conn); err != nil {
+            return err
+        }
+        return w.flush()
+    }
+}
+
+// listTarget devuelve las entradas de arg: el contenido si es un directorio
+// o la propia entrada si es un archivo. Ignora opciones estilo "-la".
+func (s *session) listTarget(arg string) ([]fs.FileInfo, error) {
+    var parts []string
+    for _, field := range strings.Fields(arg) {
+        if !strings.HasPrefix(field, "-") {
+            parts = append(parts, field)
+        }
+    }
+    name := s.resolve(strings.Join(parts, " "))
+
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return []fs.FileInfo{info}, nil
+    }
+    return s.srv.FS.ReadDir(name)
+}
+
+// sendLines envía lines por la conexión de datos terminadas en CRLF.
+func (s *session) sendLines(lines []string) {
+    s.transfer(func(conn net.Conn) error {
+        var b bytes.Buffer
+        for _, line := range lines {
+            b.WriteString(line)
+            b.WriteString("\r\n")
+        }
+        _, err := conn.Write(b.Bytes())
+        return err
+    })
+}
+
+func (s *session) handleList(arg string) {
+    infos, err := s.listTarget(arg)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    lines := make([]string, 0, len(infos))
+    for _, info := range infos {
+        lines = append(lines, listLine(info))
+    }
+    s.sendLines(lines)
+}
+
+func (s *session) handleNlst(arg string) {
+    infos, err := s.listTarget(arg)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    lines := make([]string, 0, len(infos))
+    for _, info := range infos {
+        lines = append(lines, info.Name())
+    }
+    s.sendLines(lines)
+}
+
+func (s *session) handleMlsd(arg string) {
+    name := s.resolve(arg)
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if !info.IsDir() {
+        s.reply(501, "No es un directorio")
+        return
+    }
+    infos, err := s.srv.FS.ReadDir(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    lines := make([]string, 0, len(infos))
+    for _, info := range infos {
+        lines = append(lines, factsLine(info, info.Name()))
+    }
+    s.sendLines(lines)
+}
+
+func (s *session) handleMlst(arg string) {
+    name := s.resolve(arg)
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    s.replyLines(250, "Listado de "+name, []string{factsLine(info, name)}, "Fin")
+}
+
+func (s *session) handleMkd(arg string) {
+    name := s.resolve(arg)
+    if err := s.srv.FS.Mkdir(name); err != nil {
+        s.replyError(err)
+        return
+    }
+    s.reply(257, "\"%s\" creado", strings.ReplaceAll(name, "\"", "\"\""))
+}
+
+func (s *session) handleRmd(arg string) {
+    name := s.resolve(arg)
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if !info.IsDir() {
+        s.reply(550, "No es un directorio")
+        return
+    }
+    if err := s.srv.FS.Remove(name); err != nil {
+        s.replyError(err)
+        return
+    }
+    s.reply(250, "Directorio eliminado")
+}
+
+func (s *session) handleDele(arg string) {
+    name := s.resolve(arg)
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if info.IsDir() {
+        s.reply(550, "Es un directorio")
+        return
+    }
+    if err := s.srv.FS.Remove(name); err != nil {
+        s.replyError(err)
+        return
+    }
+    s.reply(250, "Archivo eliminado")
+}
+
+func (s *session) handleRnfr(arg string) {
+    name := s.resolve(arg)
+    if _, err := s.srv.FS.Stat(name); err != nil {
+        s.replyError(err)
+        return
+    }
+    s.from = name
+    s.reply(350, "Listo para RNTO")
+}
+
+func (s *session) handleRnto(arg string) {
+    if s.from == "" {
+        s.reply(503, "Use RNFR primero")
+        return
+    }
+    from := s.from
+    s.from = ""
+    if err := s.srv.FS.Rename(from, s.resolve(arg)); err != nil {
+        s.replyError(err)
+        return
+    }
+    s.reply(250, "Renombrado")
+}
+
+func (s *session) handleSize(arg string) {
+    info, err := s.srv.FS.Stat(s.resolve(arg))
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if info.IsDir() {
+        s.reply(550, "Es un directorio")
+        return
+    }
+    s.reply(213, "%d", info.Size())
+}
+
+// handleHash responde con el hash del archivo completo (draft-bryan-ftpext-hash).
+func (s *session) handleHash(arg string) {
+    s.replyHash(arg, s.hashAlgo(), true)
+}
+
+// xhash atiende XCRC, XMD5, XSHA1, XSHA256 o XSHA512, que responden solo
+// con el hash.
+func xhash(algo string) func(*session, string) {
+    return func(s *session, arg string) {
+        s.replyHash(arg, algo, false)
+    }
+}
+
+func (s *session) replyHash(arg, algo string, full bool) {
+    name := s.resolve(arg)
+    info, err := s.srv.FS.Stat(name)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if info.IsDir() {
+        s.reply(550, "Es un directorio")
+        return
+    }
+    sum, err := fileHash(s.srv.FS, name, algo)
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    if full {
+        s.reply(213, "%s 0-%d %s %s", algo, max(info.Size()-1, 0), sum, arg)
+        return
+    }
+    s.reply(250, "%s", sum)
+}
+
+func (s *session) handleMdtm(arg string) {
+    info, err := s.srv.FS.Stat(s.resolve(arg))
+    if err != nil {
+        s.replyError(err)
+        return
+    }
+    s.reply(213, "%s", info.ModTime().UTC().Format("20060102150405"))
+}
+
+// listLine da formato a una entrada de LIST al estilo de ls -l.
+func listLine(info fs.FileInfo) string {
+    mod := info.ModTime()
+    date := mod.Format("Jan _2 15:04")
+    if time.Since(mod) > 180*24*time.Hour || mod.After(time.Now()) {
+        date = mod.Format("Jan _2  2006")
+    }
+    return fmt.Sprintf("%s 1 ftp ftp %12d %s %s", info.Mode().String(), info.Size(), date, info.Name())
+}
+
+// factsLine da formato a una entrada de MLSD o MLST (RFC 3659).
+func factsLine(info fs.FileInfo, name string) string {
+    kind := "file"
+    if info.IsDir() {
+        kind = "dir"
+    }
+    return fmt.Sprintf("type=%s;size=%d;modify=%s; %s",
+        kind, info.Size(), info.ModTime().UTC().Format("20060102150405"), name)
+}
+
+// crlfWriter convierte LF en CRLF para las descargas en modo ASCII.
+type crlfWriter struct {
+    w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+    if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+// lfWriter convierte CRLF en LF para las subidas en modo ASCII; un CR al
+// final de un bloque se retiene hasta ver el byte siguiente.
+type lfWriter struct {
+    w  io.Writer
+    cr bool
+}
+
+func (l *lfWriter) Write(p []byte) (int, error) {
+    out := make([]byte, 0, len(p)+1)
+    for _, b := range p {
+        if l.cr && b != '\n' {
+            out = append(out, '\r')
+        }
+        l.cr = b == '\r'
+        if !l.cr {
+            out = append(out, b)
+        }
+    }
+    if _, err := l.w.Write(out); err != nil {
+        return 0, err
+    }
+    return len(p), nil
+}
+
+func (l *lfWriter) flush() error {
+    if !l.cr {
+        return nil
+    }
+    l.cr = false
+    _, err := l.w.Write([]byte{'\r'})
+    return err
+}
@@ -0,0 +1,67 @@
+package ftp
+
+import (
+    "sync"
+
+    "github.com/pkg/sftp"
+)
+
+// SFTPTuning ajusta el rendimiento de las transferencias SFTP en enlaces con
+// mucha latencia. Los valores cero conservan los de github.com/pkg/sftp:
+// lecturas concurrentes, escrituras secuenciales y paquetes de 32KB.
+type SFTPTuning struct {
+    // Concurrency es el máximo de peticiones simultáneas por archivo. Un
+    // valor mayor que 1 activa también las escrituras concurrentes; 1 hace
+    // que lecturas y escrituras sean secuenciales.
+    Concurrency int
+    // PacketSize es el tamaño máximo de paquete. Valores mayores que 32768
+    // no los admiten todos los servidores.
+    PacketSize int
+}
+
+var (
+    tuningMu     sync.RWMutex
+    tuningGlobal SFTPTuning
+)
+
+// SetSFTPTuning cambia el ajuste usado por las llamadas sin WithSFTPTuning.
+func SetSFTPTuning(t SFTPTuning) {
+    tuningMu.Lock()
+    tuningGlobal = t
+    tuningMu.Unlock()
+}
+
+func currentSFTPTuning() SFTPTuning {
+    tuningMu.RLock()
+    defer tuningMu.RUnlock()
+    return tuningGlobal
+}
+
+func (t SFTPTuning) concurrentWrites() bool {
+    return t.Concurrency > 1
+}
+
+// packetSize es el tamaño de paquete efectivo.
+func (t SFTPTuning) packetSize() int {
+    if t.PacketSize > 0 {
+        return t.PacketSize
+    }
+    return 32768
+}
+
+func (t SFTPTuning) clientOptions() []sftp.ClientOption {
+    var opts []sftp.ClientOption
+    switch {
+    case t.Concurrency == 1:
+        opts = append(opts, sftp.UseConcurrentReads(false), sftp.UseConcurrentWrites(false))
+    case t.Concurrency > 1:
+        opts = append(opts,
+            sftp.UseConcurrentReads(true),
+            sftp.UseConcurrentWrites(true),
+            sftp.MaxConcurrentRequestsPerFile(t.Concurrency))
+    }
+    if t.PacketSize > 0 {
+        opts = append(opts, sftp.MaxPacketUnchecked(t.PacketSize))
+    }
+    return opts
+}
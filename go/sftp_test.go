@@ -0,0 +1,338 @@
+package ftp
+
+import (
+    "bytes"
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/pem"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/IngenieroRicardo/ftp/go/server"
+    "golang.org/x/crypto/ssh"
+)
+
+func TestSFTPAppend(t *testing.T) {
+    mem := server.NewMemFS()
+    mem.Mkdir("/dir")
+    srv, err := server.StartSFTP(mem, map[string]string{"u": "p"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    url := srv.URL("u", "p", "/log.txt")
+    for _, line := range []string{"uno\n", "dos\n", "tres\n"} {
+        if err := AppendFTPFile(base64.StdEncoding.EncodeToString([]byte(line)), url); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if got, _ := mem.ReadFile("/log.txt"); string(got) != "uno\ndos\ntres\n" {
+        t.Fatalf("contenido %q", got)
+    }
+
+    // Anexar a un directorio falla al abrir, sin dejar el archivo abierto
+    if err := AppendFTPFile("eA==", srv.URL("u", "p", "/dir")); ErrorCode(err) != ErrSftpOperation {
+        t.Fatalf("anexar a un directorio: %v", err)
+    }
+}
+
+// sftpKey genera una clave ed25519 y la guarda en formato OpenSSH,
+// cifrada si passphrase no está vacía.
+func sftpKey(t *testing.T, passphrase string) (ssh.Signer, string) {
+    t.Helper()
+    _, key, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    signer, err := ssh.NewSignerFromKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var block *pem.Block
+    if passphrase != "" {
+        block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+    } else {
+        block, err = ssh.MarshalPrivateKey(key, "")
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "id_ed25519")
+    if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return signer, path
+}
+
+// connectSFTP abre un cliente con createSFTPClient y comprueba que funciona.
+func connectSFTP(rawUrl string) error {
+    u, err := parseURL(rawUrl, "sftp")
+    if err != nil {
+        return err
+    }
+    client, conn, err := createSFTPClient(context.Background(), u, SFTPTuning{})
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    defer client.Close()
+    _, err = client.Getwd()
+    return err
+}
+
+func TestCreateSFTPClient(t *testing.T) {
+    clientKey, keyPath := sftpKey(t, "")
+    otherKey, otherPath := sftpKey(t, "")
+
+    srv := server.NewSFTP(server.NewMemFS(), map[string]string{"u": "p"})
+    srv.AuthorizedKeys = map[string][]ssh.PublicKey{"u": {clientKey.PublicKey()}}
+    if err := srv.Listen("127.0.0.1:0"); err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    base := "sftp://u@" + srv.Addr() + "/"
+    pinned := url.QueryEscape(ssh.FingerprintSHA256(srv.PublicKey()))
+    wrong := url.QueryEscape(ssh.FingerprintSHA256(otherKey.PublicKey()))
+    cases := []struct {
+        name string
+        url  string
+        code int
+    }{
+        {"contraseña", srv.URL("u", "p", "/"), 0},
+        {"contraseña incorrecta", srv.URL("u", "x", "/"), ErrSftpConnection},
+        {"clave privada", base + "?key=" + url.QueryEscape(keyPath), 0},
+        {"clave no autorizada", base + "?key=" + url.QueryEscape(otherPath), ErrSftpConnection},
+        {"clave inexistente", base + "?key=" + url.QueryEscape(keyPath+".no"), ErrSftpConnection},
+        {"huella correcta", srv.URL("u", "p", "/") + "?hostkey=" + pinned, 0},
+        // Un "+" sin codificar llega como espacio y se restaura
+        {"huella sin codificar", srv.URL("u", "p", "/") + "?hostkey=" + ssh.FingerprintSHA256(srv.PublicKey()), 0},
+        {"huella distinta", srv.URL("u", "p", "/") + "?hostkey=" + wrong, ErrSftpConnection},
+        {"clave y huella", base + "?key=" + url.QueryEscape(keyPath) + "&hostkey=" + pinned, 0},
+    }
+    for _, c := range cases {
+        if err := connectSFTP(c.url); ErrorCode(err) != c.code {
+            t.Errorf("%s: %v, se esperaba el código %d", c.name, err, c.code)
+        }
+    }
+}
+
+func TestLoadPrivateKeyPassphrase(t *testing.T) {
+    signer, path := sftpKey(t, "frase")
+    got, err := loadPrivateKey(path, "frase")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(got.PublicKey().Marshal(), signer.PublicKey().Marshal()) {
+        t.Fatal("la clave cargada no coincide")
+    }
+    if _, err := loadPrivateKey(path, ""); err == nil {
+        t.Fatal("se cargó una clave cifrada sin frase")
+    }
+}
+
+func TestSFTPRoundTrip(t *testing.T) {
+    mem := server.NewMemFS()
+    srv, err := server.StartSFTP(mem, map[string]string{"u": "p"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer srv.Close()
+
+    if err := CreateSFTPDir(srv.URL("u", "p", "/a/b")); err != nil {
+        t.Fatal(err)
+    }
+    // Crear un directorio existente no es un error
+    if err := CreateSFTPDir(srv.URL("u", "p", "/a/b")); err != nil {
+        t.Fatal(err)
+    }
+    if info, err := mem.Stat("/a/b"); err != nil || !info.IsDir() {
+        t.Fatalf("directorio no creado: %v", err)
+    }
+
+    data := make([]byte, 200<<10)
+    for i := range data {
+        data[i] = byte(i * 7)
+    }
+    encoded := base64.StdEncoding.EncodeToString(data)
+    if err := PutSFTPFile(encoded, srv.URL("u", "p", "/a/b/datos.bin")); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := mem.ReadFile("/a/b/datos.bin"); !bytes.Equal(got, data) {
+        t.Fatalf("subidos %d bytes distintos", len(got))
+    }
+    if got := GetSFTPFile(srv.URL("u", "p", "/a/b/datos.bin")); got != encoded {
+        t.Fatalf("descargados %d caracteres distintos", len(got))
+    }
+    mem.WriteFile("/a/b/otro.txt", []byte("x"))
+    if got := ListSFTPFiles(srv.URL("u", "p", "/a/b")); !reflect.DeepEqual(got, []string{"datos.bin", "otro.txt"}) {
+        t.Fatalf("listado %q", got)
+    }
+
+    // Los errores de las funciones que no devuelven error quedan vacíos
+    if got := GetSFTPFile(srv.URL("u", "p", "/no-existe")); got != "" {
+        t.Fatalf("descarga inexistente %q", got)
+    }
+    if got := ListSFTPFiles(srv.URL("u", "p", "/no-existe")); got != nil {
+        t.Fatalf("listado inexistente %q", got)
+    }
+    // SFTP crea por omisión los directorios que falten, salvo con ?mkdirs=0
+    if err := PutSFTPFile(encoded, srv.URL("u", "p", "/c/datos.bin")); err != nil {
+        t.Fatal(err)
+    }
+    if err := PutSFTPFile(encoded, srv.URL("u", "p", "/d/datos.bin")+"?mkdirs=0"); ErrorCode(err) != ErrSftpOperation {
+        t.Fatalf("subida sin crear directorios: %v", err)
+    }
+    if err := PutSFTPFile("", srv.URL("u", "p", "/vacio")); ErrorCode(err) != ErrEmptyData {
+        t.Fatalf("subida vacía: %v", err)
+    }
+    if err := PutSFTPFile(encoded, srv.URL("u", "x", "/datos.bin")); ErrorCode(err) != ErrSftpConnection {
+        t.Fatalf("contraseña incorrecta: %v", err)
+    }
+}
+
+// sftpTunings son los ajustes que comparan las pruebas de rendimiento.
+// El servidor de github.com/pkg/sftp responde a las lecturas con 32KB como
+// máximo, así que los paquetes mayores solo se prueban al subir.
+var sftpTunings = []struct {
+    name       string
+    tuning     SFTPTuning
+    uploadOnly bool
+}{
+    {"default", SFTPTuning{}, false},
+    {"secuencial", SFTPTuning{Concurrency: 1}, false},
+    {"concurrente", SFTPTuning{Concurrency: 64, PacketSize: 32768}, false},
+    {"concurrente-64k", SFTPTuning{Concurrency: 64, PacketSize: 65536}, true},
+}
+
+// delayProxy reenvía las conexiones a addr retrasando cada bloque delay en
+// cada sentido, sin limitar el caudal, para simular un enlace lejano.
+func delayProxy(b *testing.B, addr string, delay time.Duration) string {
+    b.Helper()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        b.Fatal(err)
+    }
+    b.Cleanup(func() { l.Close() })
+
+    pipe := func(dst, src net.Conn) {
+        type chunk struct {
+            data []byte
+            at   time.Time
+        }
+        queue := make(chan chunk, 1024)
+        go func() {
+            defer dst.Close()
+            for c := range queue {
+                time.Sleep(time.Until(c.at))
+                if _, err := dst.Write(c.data); err != nil {
+                    return
+                }
+            }
+        }()
+        defer close(queue)
+        buf := make([]byte, 64<<10)
+        for {
+            n, err := src.Read(buf)
+            if n > 0 {
+                queue <- chunk{append([]byte(nil), buf[:n]...), time.Now().Add(delay)}
+            }
+            if err != nil {
+                return
+            }
+        }
+    }
+    go func() {
+        for {
+            client, err := l.Accept()
+            if err != nil {
+                return
+            }
+            remote, err := net.Dial("tcp", addr)
+            if err != nil {
+                client.Close()
+                continue
+            }
+            go pipe(remote, client)
+            go pipe(client, remote)
+        }
+    }()
+    return l.Addr().String()
+}
+
+// benchSFTP arranca un servidor SFTP en memoria con /datos.bin de 8MB.
+func benchSFTP(b *testing.B) (*server.SFTPServer, *server.MemFS, []byte) {
+    b.Helper()
+    data := make([]byte, 8<<20)
+    rand.Read(data)
+    mem := server.NewMemFS()
+    mem.WriteFile("/datos.bin", data)
+    srv, err := server.StartSFTP(mem, map[string]string{"u": "p"})
+    if err != nil {
+        b.Fatal(err)
+    }
+    b.Cleanup(func() { srv.Close() })
+    return srv, mem, data
+}
+
+// sftpLinks son el servidor directo y el mismo tras 2ms de retardo en cada
+// sentido, donde se nota la concurrencia.
+func sftpLinks(b *testing.B, srv *server.SFTPServer, path string) [][2]string {
+    local := srv.URL("u", "p", path)
+    remote := strings.Replace(local, srv.Addr(), delayProxy(b, srv.Addr(), 2*time.Millisecond), 1)
+    return [][2]string{{"local", local}, {"latencia-4ms", remote}}
+}
+
+func BenchmarkSFTPDownload(b *testing.B) {
+    srv, _, data := benchSFTP(b)
+    for _, link := range sftpLinks(b, srv, "/datos.bin") {
+        url := link[1]
+        for _, c := range sftpTunings {
+            if c.uploadOnly {
+                continue
+            }
+            b.Run(link[0]+"/"+c.name, func(b *testing.B) {
+                b.SetBytes(int64(len(data)))
+                for i := 0; i < b.N; i++ {
+                    got, err := GetFTPBytes(url, WithSFTPTuning(c.tuning))
+                    if err != nil {
+                        b.Fatal(err)
+                    }
+                    if len(got) != len(data) {
+                        b.Fatalf("descargados %d bytes", len(got))
+                    }
+                }
+            })
+        }
+    }
+}
+
+func BenchmarkSFTPUpload(b *testing.B) {
+    srv, mem, data := benchSFTP(b)
+    for _, link := range sftpLinks(b, srv, "/subida.bin") {
+        url := link[1]
+        for _, c := range sftpTunings {
+            b.Run(link[0]+"/"+c.name, func(b *testing.B) {
+                b.SetBytes(int64(len(data)))
+                for i := 0; i < b.N; i++ {
+                    if err := PutFTPBytes(data, url, WithSFTPTuning(c.tuning)); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+                b.StopTimer()
+                if got, _ := mem.ReadFile("/subida.bin"); !bytes.Equal(got, data) {
+                    b.Fatalf("subidos %d bytes distintos", len(got))
+                }
+            })
+        }
+    }
+}
@@ -0,0 +1,202 @@
+package ftp
+
+import (
+    "encoding/binary"
+    "net/url"
+    "strconv"
+    "strings"
+    "unicode/utf16"
+)
+
+// TextOptions controla cómo GetFTPText, PutFTPText y AppendFTPText
+// convierten el texto. Sin ellas el texto se lee en modo ASCII, se pasa a LF
+// y se recortan los espacios de los extremos, y se escribe con CRLF. Con
+// ellas se transfiere en binario y la conversión la hace el cliente, igual
+// en FTP que en SFTP.
+type TextOptions struct {
+    // LineEnding es lf, crlf o preserve. Vacío equivale a lf al leer y a
+    // preserve al escribir.
+    LineEnding string
+    // NoTrim conserva los espacios y saltos del principio y el final al leer.
+    NoTrim bool
+    // BOM es keep para conservar la marca de orden de bytes al leer o add
+    // para escribirla. Vacío la quita al leer y no la escribe, salvo en utf-16.
+    BOM string
+    // Charset es la codificación del archivo remoto: utf-8 (por defecto),
+    // utf-16, utf-16le, utf-16be, latin1 o cp1252. utf-16 detecta el orden
+    // por la marca al leer (sin ella supone little-endian) y la escribe.
+    Charset string
+}
+
+// WithText convierte el texto según t. Equivale a los parámetros de URL
+// eol, trim, bom y encoding, que tienen prioridad.
+func WithText(t TextOptions) Option {
+    return func(cfg *config) {
+        cfg.text = &t
+    }
+}
+
+// byteOrderMark es U+FEFF, que al principio de un texto indica su
+// codificación.
+const byteOrderMark = "\uFEFF"
+
+var (
+    lineEndings = oneOf("lf", "crlf", "preserve")
+    bomModes    = oneOf("keep", "add")
+)
+
+// textCharset normaliza el nombre de la codificación de un texto; "" es
+// UTF-8.
+func textCharset(name string) (string, bool) {
+    switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+    case "utf-16", "utf16":
+        return "utf-16", true
+    case "utf-16le", "utf16le":
+        return "utf-16le", true
+    case "utf-16be", "utf16be":
+        return "utf-16be", true
+    }
+    return charsetName(name)
+}
+
+// textOptions devuelve las opciones de texto de cfg con los parámetros de
+// ftpUrl aplicados encima, o nil si no se pidió ninguna.
+func (cfg *config) textOptions(ftpUrl string) (*TextOptions, error) {
+    var t TextOptions
+    explicit := cfg.text != nil
+    if explicit {
+        t = *cfg.text
+    }
+    // Los valores de la URL ya los valida parseURL
+    if u, err := url.Parse(ftpUrl); err == nil {
+        query := u.Query()
+        if v := query.Get("eol"); v != "" {
+            t.LineEnding, explicit = v, true
+        }
+        if v, err := strconv.ParseBool(query.Get("trim")); err == nil {
+            t.NoTrim, explicit = !v, true
+        }
+        if v := query.Get("bom"); v != "" {
+            t.BOM, explicit = v, true
+        }
+        if v := query.Get("encoding"); v != "" {
+            t.Charset, explicit = v, true
+        }
+    }
+    if !explicit {
+        return nil, nil
+    }
+
+    if t.LineEnding != "" && !lineEndings(t.LineEnding) {
+        return nil, errorf(ErrInvalidOption, "fin de línea desconocido: %s", t.LineEnding)
+    }
+    if t.BOM != "" && !bomModes(t.BOM) {
+        return nil, errorf(ErrInvalidOption, "modo de BOM desconocido: %s", t.BOM)
+    }
+    charset, ok := textCharset(t.Charset)
+    if !ok {
+        return nil, errorf(ErrInvalidOption, "codificación desconocida: %s", t.Charset)
+    }
+    t.LineEnding, t.BOM, t.Charset = strings.ToLower(t.LineEnding), strings.ToLower(t.BOM), charset
+    return &t, nil
+}
+
+// decode pasa a texto el contenido descargado.
+func (t *TextOptions) decode(data []byte) string {
+    var text string
+    bom := false
+    switch t.Charset {
+    case "utf-16", "utf-16le", "utf-16be":
+        order := binary.ByteOrder(binary.LittleEndian)
+        if t.Charset == "utf-16be" {
+            order = binary.BigEndian
+        }
+        switch {
+        case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE && t.Charset != "utf-16be":
+            order, data, bom = binary.LittleEndian, data[2:], true
+        case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF && t.Charset != "utf-16le":
+            order, data, bom = binary.BigEndian, data[2:], true
+        }
+        units := make([]uint16, len(data)/2)
+        for i := range units {
+            units[i] = order.Uint16(data[2*i:])
+        }
+        text = string(utf16.Decode(units))
+        // Un byte suelto al final no forma un carácter
+        if len(data)%2 != 0 {
+            text += "\uFFFD"
+        }
+    case "":
+        text = string(data)
+        if strings.HasPrefix(text, byteOrderMark) {
+            text, bom = text[len(byteOrderMark):], true
+        }
+    default:
+        text = decodeText(t.Charset, string(data))
+    }
+    if bom && t.BOM == "keep" {
+        text = byteOrderMark + text
+    }
+
+    switch t.LineEnding {
+    case "", "lf":
+        text = strings.ReplaceAll(text, "\r\n", "\n")
+    case "crlf":
+        text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+    }
+    if !t.NoTrim {
+        text = strings.TrimSpace(text)
+    }
+    return text
+}
+
+// encodeText pasa textData a los bytes que se suben a ftpUrl. Al anexar a un
+// archivo con contenido se omite la BOM, que solo vale al principio.
+func (cfg *config) encodeText(t *TextOptions, textData, ftpUrl string) ([]byte, error) {
+    continued := false
+    if cfg.appending && (t.BOM == "add" || t.Charset == "utf-16") {
+        // Si no se puede consultar se supone que el archivo no existe
+        info, err := statFile(ftpUrl, cfg)
+        continued = err == nil && info.Size > 0
+    }
+    return t.encode(textData, continued)
+}
+
+// encode pasa text a los bytes que se suben; continued indica que se anexan
+// tras contenido existente y no llevan BOM.
+func (t *TextOptions) encode(text string, continued bool) ([]byte, error) {
+    switch t.LineEnding {
+    case "lf":
+        text = strings.ReplaceAll(text, "\r\n", "\n")
+    case "crlf":
+        text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+    }
+    switch {
+    case continued:
+        text = strings.TrimPrefix(text, byteOrderMark)
+    case t.BOM == "add" || t.Charset == "utf-16":
+        text = byteOrderMark + strings.TrimPrefix(text, byteOrderMark)
+    }
+
+    switch t.Charset {
+    case "utf-16", "utf-16le", "utf-16be":
+        order := binary.ByteOrder(binary.LittleEndian)
+        if t.Charset == "utf-16be" {
+            order = binary.BigEndian
+        }
+        units := utf16.Encode([]rune(text))
+        data := make([]byte, 2*len(units))
+        for i, unit := range units {
+            order.PutUint16(data[2*i:], unit)
+        }
+        return data, nil
+    case "":
+        return []byte(text), nil
+    }
+    // La marca no existe en las páginas de códigos de un byte
+    encoded, err := encodeText(t.Charset, strings.TrimPrefix(text, byteOrderMark))
+    if err != nil {
+        return nil, wrapError(ErrInvalidOption, err, "texto no representable en "+t.Charset)
+    }
+    return []byte(encoded), nil
+}
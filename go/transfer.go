@@ -0,0 +1,255 @@
+package ftp
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "os"
+)
+
+// sink es el destino de una descarga. offset indica cuánto se recibió ya,
+// para reanudar, reset descarta lo recibido cuando no se puede reanudar y
+// copyTo vuelve a leerlo para verificarlo.
+type sink interface {
+    io.Writer
+    offset() int64
+    reset() error
+    copyTo(w io.Writer) error
+}
+
+type bufferSink struct {
+    bytes.Buffer
+}
+
+func (b *bufferSink) offset() int64 {
+    return int64(b.Len())
+}
+
+func (b *bufferSink) reset() error {
+    b.Reset()
+    return nil
+}
+
+func (b *bufferSink) copyTo(w io.Writer) error {
+    _, err := w.Write(b.Bytes())
+    return err
+}
+
+type fileSink struct {
+    *os.File
+}
+
+func (f fileSink) offset() int64 {
+    pos, err := f.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return 0
+    }
+    return pos
+}
+
+func (f fileSink) reset() error {
+    if err := f.Truncate(0); err != nil {
+        return err
+    }
+    _, err := f.Seek(0, io.SeekStart)
+    return err
+}
+
+func (f fileSink) copyTo(w io.Writer) error {
+    _, err := io.Copy(w, io.NewSectionReader(f.File, 0, f.offset()))
+    return err
+}
+
+// writerSink escribe una descarga en un io.Writer cualquiera, como una
+// tubería: puede continuar tras un corte, pero no empezar de nuevo ni volver
+// a leerse.
+type writerSink struct {
+    w io.Writer
+    n int64
+}
+
+func (s *writerSink) Write(b []byte) (int, error) {
+    n, err := s.w.Write(b)
+    s.n += int64(n)
+    return n, err
+}
+
+func (s *writerSink) offset() int64 {
+    return s.n
+}
+
+func (s *writerSink) reset() error {
+    if s.n > 0 {
+        return errors.New("lo ya escrito en el destino no se puede deshacer")
+    }
+    return nil
+}
+
+func (s *writerSink) copyTo(io.Writer) error {
+    return errors.New("el destino no se puede volver a leer")
+}
+
+// streamSource es el origen de una subida que no admite Seek, como una
+// tubería: solo puede "volver" a la posición en la que ya está.
+type streamSource struct {
+    r   io.Reader
+    pos int64
+}
+
+func (s *streamSource) Read(b []byte) (int, error) {
+    n, err := s.r.Read(b)
+    s.pos += int64(n)
+    return n, err
+}
+
+func (s *streamSource) Seek(offset int64, whence int) (int64, error) {
+    if (whence == io.SeekStart && offset == s.pos) || (whence == io.SeekCurrent && offset == 0) {
+        return s.pos, nil
+    }
+    return s.pos, errors.New("el origen no se puede volver a leer")
+}
+
+// sourceSize devuelve el tamaño de src, o -1 si es un flujo.
+func sourceSize(src io.ReadSeeker) (int64, error) {
+    switch src.(type) {
+    case *streamSource, *compressSource:
+        return -1, nil
+    }
+    return src.Seek(0, io.SeekEnd)
+}
+
+// getStream descarga ftpUrl en binario y sin límite de tamaño,
+// descomprimiendo si se pidió con WithCompression.
+func getStream(ftpUrl string, dst sink, cfg *config) error {
+    c, err := cfg.compression(ftpUrl)
+    if err != nil {
+        return err
+    }
+    var zdst *decompressSink
+    if c != nil {
+        zdst = &decompressSink{dst: dst, codec: c}
+        dst = zdst
+    }
+    if isSFTP(ftpUrl) {
+        err = getSFTP(ftpUrl, dst, math.MaxInt64, cfg)
+    } else {
+        err = getFTP(ftpUrl, "I", dst, math.MaxInt64, cfg)
+    }
+    if zdst != nil {
+        if err == nil {
+            return zdst.finish()
+        }
+        zdst.stop(err)
+    }
+    return err
+}
+
+// putStream sube src en binario, comprimiéndolo si se pidió con
+// WithCompression.
+func putStream(ftpUrl string, src io.ReadSeeker, cfg *config) error {
+    c, err := cfg.compression(ftpUrl)
+    if err != nil {
+        return err
+    }
+    if c != nil {
+        zsrc := newCompressSource(src, c)
+        defer zsrc.close()
+        src = zsrc
+    }
+    if isSFTP(ftpUrl) {
+        return putSFTP(ftpUrl, src, cfg)
+    }
+    return putFTP(ftpUrl, src, "I", cfg)
+}
+
+// DownloadFTPFile guarda el archivo remoto en localPath sin pasar por memoria
+// ni aplicar el límite de 90MB. En SFTP usa File.WriteTo, que lee en
+// paralelo según SFTPTuning. Si falla, localPath se elimina.
+func DownloadFTPFile(ftpUrl, localPath string, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    if localPath == "" {
+        return fmt.Errorf("error code %d: falta path local", ErrMissingPath)
+    }
+
+    file, err := os.Create(localPath)
+    if err != nil {
+        return wrapError(ErrDataTransfer, err, "error creando archivo local")
+    }
+
+    err = getStream(ftpUrl, fileSink{file}, newConfig(opts))
+    if closeErr := file.Close(); err == nil && closeErr != nil {
+        err = wrapError(ErrDataTransfer, closeErr, "error escribiendo archivo local")
+    }
+    if err != nil {
+        os.Remove(localPath)
+    }
+    return err
+}
+
+// UploadFTPFile sube localPath a la URL leyendo directamente del archivo. En
+// SFTP usa File.ReadFrom, que escribe en paralelo según SFTPTuning.
+func UploadFTPFile(localPath, ftpUrl string, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+    if localPath == "" {
+        return fmt.Errorf("error code %d: falta path local", ErrMissingPath)
+    }
+
+    file, err := os.Open(localPath)
+    if err != nil {
+        return wrapError(ErrEmptyData, err, "error abriendo archivo local")
+    }
+    defer file.Close()
+
+    cfg := newConfig(opts)
+    if info, err := file.Stat(); err == nil {
+        cfg.modTime = info.ModTime()
+    }
+    return putStream(ftpUrl, file, cfg)
+}
+
+// GetFTPTo descarga el archivo remoto, FTP o SFTP, escribiéndolo en w a
+// medida que llega y sin límite de tamaño. Tras un corte continúa donde
+// quedó si el servidor lo permite; no puede empezar de nuevo porque lo ya
+// escrito en w no se puede deshacer, ni verificarse con WithVerify.
+func GetFTPTo(ftpUrl string, w io.Writer, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+
+    return getStream(ftpUrl, &writerSink{w: w}, newConfig(opts))
+}
+
+// PutFTPFrom sube lo que se lea de r hasta el final. Un archivo regular se
+// sube desde su posición actual, que al terminar queda al final, y se
+// reanuda como UploadFTPFile. Una tubería o un socket se leen una sola vez:
+// tras un corte solo se puede continuar si el servidor recibió todo lo leído.
+func PutFTPFrom(r io.Reader, ftpUrl string, opts ...Option) error {
+    if ftpUrl == "" {
+        return fmt.Errorf("error code %d: URL vacía", ErrEmptyURL)
+    }
+
+    cfg := newConfig(opts)
+    var src io.ReadSeeker = &streamSource{r: r}
+    file, regular := r.(*os.File)
+    if regular {
+        start, err := file.Seek(0, io.SeekCurrent)
+        info, statErr := file.Stat()
+        regular = err == nil && statErr == nil && info.Mode().IsRegular()
+        if regular {
+            src = io.NewSectionReader(file, start, info.Size()-start)
+            cfg.modTime = info.ModTime()
+        }
+    }
+
+    err := putStream(ftpUrl, src, cfg)
+    if err == nil && regular {
+        file.Seek(0, io.SeekEnd)
+    }
+    return err
+}
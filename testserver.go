@@ -0,0 +1,85 @@
+//go:build ftptestserver
+
+// Los servidores de prueba solo se incluyen al compilar con
+// -tags ftptestserver, para que la biblioteca de producción no los lleve.
+
+package main
+
+import "C"
+import (
+    "net"
+    "strconv"
+    "sync"
+    "github.com/IngenieroRicardo/ftp/go/server"
+)
+
+var (
+    testServerMu sync.Mutex
+    testServers  = make(map[int]interface{ Close() error })
+)
+
+// startTestServer levanta un servidor de pruebas en 127.0.0.1 y retorna su
+// puerto, que sirve también para detenerlo.
+func startTestServer(rootDir, user, password *C.char, secure bool) C.int {
+    var fsys server.FileSystem = server.NewMemFS()
+    if dir := C.GoString(rootDir); dir != "" {
+        fsys = server.DirFS(dir)
+    }
+    var users map[string]string
+    if name := C.GoString(user); name != "" {
+        users = map[string]string{name: C.GoString(password)}
+    }
+
+    var srv interface {
+        Addr() string
+        Close() error
+    }
+    var err error
+    if secure {
+        srv, err = server.StartSFTP(fsys, users)
+    } else {
+        srv, err = server.Start(fsys, users)
+    }
+    if err != nil {
+        return C.int(ErrConnectionFailed)
+    }
+
+    _, portStr, _ := net.SplitHostPort(srv.Addr())
+    port, _ := strconv.Atoi(portStr)
+    testServerMu.Lock()
+    testServers[port] = srv
+    testServerMu.Unlock()
+    return C.int(port)
+}
+
+// StartFTPTestServer levanta un servidor FTP de pruebas en 127.0.0.1 sobre
+// rootDir (en memoria si es NULL o ""). Si user es NULL acepta cualquier
+// usuario. Retorna el puerto o un código de error.
+//
+//export StartFTPTestServer
+func StartFTPTestServer(rootDir, user, password *C.char) C.int {
+    return startTestServer(rootDir, user, password, false)
+}
+
+// StartSFTPTestServer es el equivalente SFTP de StartFTPTestServer, con una
+// clave de servidor generada al vuelo.
+//
+//export StartSFTPTestServer
+func StartSFTPTestServer(rootDir, user, password *C.char) C.int {
+    return startTestServer(rootDir, user, password, true)
+}
+
+// StopTestServer detiene el servidor de pruebas que escucha en port.
+//
+//export StopTestServer
+func StopTestServer(port C.int) C.int {
+    testServerMu.Lock()
+    srv := testServers[int(port)]
+    delete(testServers, int(port))
+    testServerMu.Unlock()
+    if srv == nil {
+        return C.int(ErrInvalidOption)
+    }
+    srv.Close()
+    return C.int(0)
+}